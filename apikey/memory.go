@@ -0,0 +1,92 @@
+package apikey
+
+import (
+	"sort"
+	"sync"
+)
+
+//MemoryStore in-memory api key store.
+//Data will be lost after process exit,so it should only be used in tests.
+type MemoryStore struct {
+	locker sync.RWMutex
+	keys   map[string]*Key
+}
+
+//MustInsertAPIKey insert new api key.
+func (m *MemoryStore) MustInsertAPIKey(key *Key) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	m.keys[key.ID] = key.Clone()
+}
+
+//MustFindAPIKey find api key by key id.
+//Return nil if not found.
+func (m *MemoryStore) MustFindAPIKey(id string) *Key {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+	key := m.keys[id]
+	if key == nil {
+		return nil
+	}
+	return key.Clone()
+}
+
+//MustListAPIKeys list api keys of given uid.
+func (m *MemoryStore) MustListAPIKeys(uid string) []*Key {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+	result := []*Key{}
+	for _, v := range m.keys {
+		if v.UID == uid {
+			result = append(result, v.Clone())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedTime == result[j].CreatedTime {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].CreatedTime < result[j].CreatedTime
+	})
+	return result
+}
+
+//MustRevokeAPIKey revoke api key by uid and key id.
+//Return whether key existed.
+func (m *MemoryStore) MustRevokeAPIKey(uid string, id string) bool {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	key := m.keys[id]
+	if key == nil || key.UID != uid {
+		return false
+	}
+	delete(m.keys, id)
+	return true
+}
+
+//MustRevokeAllAPIKeys revoke all api keys of given uid.
+func (m *MemoryStore) MustRevokeAllAPIKeys(uid string) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	for k, v := range m.keys {
+		if v.UID == uid {
+			delete(m.keys, k)
+		}
+	}
+}
+
+//MustTouchAPIKey update last used time of given key id.
+func (m *MemoryStore) MustTouchAPIKey(id string, lastused int64) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	key := m.keys[id]
+	if key != nil {
+		key.LastUsedTime = lastused
+	}
+}
+
+//NewMemoryStore create new in-memory api key store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys: map[string]*Key{},
+	}
+}
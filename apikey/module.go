@@ -0,0 +1,80 @@
+package apikey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/storemodule"
+)
+
+//ErrInvalidPrefix error raised when prefix contains separator.
+var ErrInvalidPrefix = errors.New("apikey:prefix should not contain separator")
+
+//ModuleName api key module name.
+const ModuleName = "apikey"
+
+//APIKey api key usersystem module.
+type APIKey struct {
+	storemodule.Module
+	*Service
+}
+
+//New create new api key module.
+func New() *APIKey {
+	a := &APIKey{
+		Service: NewService(),
+	}
+	a.Module = storemodule.New(ModuleName, func() interface{} { return a.Store })
+	return a
+}
+
+//MustNewAndInstallTo create new api key module and install to given usersystem.
+func MustNewAndInstallTo(s *usersystem.UserSystem) *APIKey {
+	a := New()
+	storemodule.MustInstallTo(s, a)
+	return a
+}
+
+//MustGetModule get api key module installed to given usersystem.
+//Return nil if not installed.
+func MustGetModule(s *usersystem.UserSystem) *APIKey {
+	m := storemodule.MustGetModule(s, ModuleName)
+	if m == nil {
+		return nil
+	}
+	return m.(*APIKey)
+}
+
+//Config api key directive config.
+type Config struct {
+	//Prefix prefix of issued keys.
+	//DefaultPrefix will be used if empty.
+	Prefix string
+}
+
+//Execute set prefix of api key module installed to usersystem.
+func (c *Config) Execute(s *usersystem.UserSystem) error {
+	if strings.Contains(c.Prefix, Separator) {
+		return ErrInvalidPrefix
+	}
+	service := MustGetModule(s)
+	if service == nil {
+		return fmt.Errorf("%w (%s)", storemodule.ErrModuleNotInstalled, ModuleName)
+	}
+	if c.Prefix != "" {
+		service.Prefix = c.Prefix
+	}
+	return nil
+}
+
+//DirectiveFactory factory to create api key directive
+var DirectiveFactory = func(loader func(v interface{}) error) (usersystem.Directive, error) {
+	c := &Config{}
+	err := loader(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,202 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+//ErrStoreNotSet error raised when api key store not set.
+var ErrStoreNotSet = errors.New("apikey:store not set")
+
+//ErrKeyNotFound error raised when api key not found.
+var ErrKeyNotFound = errors.New("apikey:key not found")
+
+//DefaultPrefix default api key prefix.
+var DefaultPrefix = "hk"
+
+//Separator separator between prefix,key id and secret.
+var Separator = "_"
+
+var keyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//Key api key data.
+//Only hash of secret is stored.
+type Key struct {
+	//ID key id.
+	ID string
+	//UID user id.
+	UID string
+	//Name key name given by user.
+	Name string
+	//Scopes key scopes.
+	Scopes []string
+	//Hash hash of key secret.
+	Hash string
+	//CreatedTime created timestamp in second.
+	CreatedTime int64
+	//ExpiredTime expired timestamp in second.
+	//Zero means never expire.
+	ExpiredTime int64
+	//LastUsedTime last used timestamp in second.
+	//Zero means never used.
+	LastUsedTime int64
+}
+
+//Clone clone key.
+func (k *Key) Clone() *Key {
+	key := *k
+	key.Scopes = make([]string, len(k.Scopes))
+	copy(key.Scopes, k.Scopes)
+	return &key
+}
+
+//Expired check if key expired at given time.
+func (k *Key) Expired(t time.Time) bool {
+	return k.ExpiredTime != 0 && k.ExpiredTime <= t.Unix()
+}
+
+//Store api key store interface
+type Store interface {
+	//MustInsertAPIKey insert new api key.
+	MustInsertAPIKey(key *Key)
+	//MustFindAPIKey find api key by key id.
+	//Return nil if not found.
+	MustFindAPIKey(id string) *Key
+	//MustListAPIKeys list api keys of given uid.
+	MustListAPIKeys(uid string) []*Key
+	//MustRevokeAPIKey revoke api key by uid and key id.
+	//Return whether key existed.
+	MustRevokeAPIKey(uid string, id string) bool
+	//MustRevokeAllAPIKeys revoke all api keys of given uid.
+	MustRevokeAllAPIKeys(uid string)
+	//MustTouchAPIKey update last used time of given key id.
+	MustTouchAPIKey(id string, lastused int64)
+}
+
+//Hash return hash of key secret.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(length int) (string, error) {
+	data := make([]byte, length)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(keyEncoding.EncodeToString(data)), nil
+}
+
+//Service api key service
+type Service struct {
+	//Store api key store.
+	Store Store
+	//Prefix key prefix.
+	Prefix string
+	//Clock clock source.
+	//default value is time.Now.
+	Clock func() time.Time
+}
+
+func (s *Service) store() Store {
+	if s.Store == nil {
+		panic(ErrStoreNotSet)
+	}
+	return s.Store
+}
+
+//Split split api key into key id and secret.
+//Return false if prefix not match or key malformed.
+func (s *Service) Split(apikey string) (string, string, bool) {
+	parts := strings.Split(apikey, Separator)
+	if len(parts) != 3 || parts[0] != s.Prefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+//MustIssue issue new api key to given uid.
+//Zero ttl means never expire.
+//Return api key which should be shown to user at once,and stored key data.
+func (s *Service) MustIssue(uid string, name string, scopes []string, ttl time.Duration) (string, *Key) {
+	id, err := randomString(10)
+	if err != nil {
+		panic(err)
+	}
+	secret, err := randomString(20)
+	if err != nil {
+		panic(err)
+	}
+	now := s.Clock()
+	key := &Key{
+		ID:          id,
+		UID:         uid,
+		Name:        name,
+		Scopes:      make([]string, len(scopes)),
+		Hash:        Hash(secret),
+		CreatedTime: now.Unix(),
+	}
+	copy(key.Scopes, scopes)
+	if ttl > 0 {
+		key.ExpiredTime = now.Add(ttl).Unix()
+	}
+	s.store().MustInsertAPIKey(key)
+	return s.Prefix + Separator + id + Separator + secret, key.Clone()
+}
+
+//MustLookup lookup api key.
+//Last used time will be updated if key valid.
+//Return uid and scopes,or empty uid if key invalid or expired.
+func (s *Service) MustLookup(apikey string) (string, []string) {
+	id, secret, ok := s.Split(apikey)
+	if !ok {
+		return "", nil
+	}
+	store := s.store()
+	key := store.MustFindAPIKey(id)
+	if key == nil {
+		return "", nil
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(Hash(secret))) != 1 {
+		return "", nil
+	}
+	now := s.Clock()
+	if key.Expired(now) {
+		return "", nil
+	}
+	store.MustTouchAPIKey(id, now.Unix())
+	return key.UID, key.Scopes
+}
+
+//MustList list api keys of given uid.
+func (s *Service) MustList(uid string) []*Key {
+	return s.store().MustListAPIKeys(uid)
+}
+
+//MustRevoke revoke api key of given uid by key id.
+//If key not found,ErrKeyNotFound will be raised.
+func (s *Service) MustRevoke(uid string, id string) {
+	if !s.store().MustRevokeAPIKey(uid, id) {
+		panic(ErrKeyNotFound)
+	}
+}
+
+//MustRevokeAll revoke all api keys of given uid.
+func (s *Service) MustRevokeAll(uid string) {
+	s.store().MustRevokeAllAPIKeys(uid)
+}
+
+//NewService create new api key service.
+func NewService() *Service {
+	return &Service{
+		Prefix: DefaultPrefix,
+		Clock:  time.Now,
+	}
+}
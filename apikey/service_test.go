@@ -0,0 +1,114 @@
+package apikey
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/usersystem"
+)
+
+func TestService(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	s := NewService()
+	s.Clock = func() time.Time {
+		return now
+	}
+	s.Store = NewMemoryStore()
+	key, data := s.MustIssue("test", "cli", []string{"read", "write"}, 0)
+	if !strings.HasPrefix(key, "hk_"+data.ID+"_") || data.UID != "test" || data.Name != "cli" || data.ExpiredTime != 0 {
+		t.Fatal(key, data)
+	}
+	if strings.Contains(data.Hash, strings.Split(key, "_")[2]) {
+		t.Fatal(data)
+	}
+	uid, scopes := s.MustLookup(key)
+	if uid != "test" || len(scopes) != 2 || scopes[0] != "read" || scopes[1] != "write" {
+		t.Fatal(uid, scopes)
+	}
+	keys := s.MustList("test")
+	if len(keys) != 1 || keys[0].LastUsedTime != now.Unix() {
+		t.Fatal(keys)
+	}
+	for _, v := range []string{"", "hk", "hk__", "other_" + data.ID + "_secret", "hk_" + data.ID + "_wrongsecret", "hk_notexist_secret", key + "_"} {
+		uid, _ = s.MustLookup(v)
+		if uid != "" {
+			t.Fatal(v)
+		}
+	}
+	expiring, _ := s.MustIssue("test", "expiring", nil, time.Hour)
+	uid, _ = s.MustLookup(expiring)
+	if uid != "test" {
+		t.Fatal(uid)
+	}
+	now = now.Add(time.Hour)
+	uid, _ = s.MustLookup(expiring)
+	if uid != "" {
+		t.Fatal(uid)
+	}
+	other, otherdata := s.MustIssue("other", "other", nil, 0)
+	if len(s.MustList("test")) != 2 || len(s.MustList("other")) != 1 {
+		t.Fatal()
+	}
+	err := herbsystem.Catch(func() {
+		s.MustRevoke("test", otherdata.ID)
+	})
+	if err != ErrKeyNotFound {
+		t.Fatal(err)
+	}
+	s.MustRevoke("test", data.ID)
+	uid, _ = s.MustLookup(key)
+	if uid != "" {
+		t.Fatal(uid)
+	}
+	s.MustRevokeAll("test")
+	if len(s.MustList("test")) != 0 {
+		t.Fatal()
+	}
+	uid, _ = s.MustLookup(other)
+	if uid != "other" {
+		t.Fatal(uid)
+	}
+}
+
+func TestDirective(t *testing.T) {
+	s := usersystem.New()
+	module := MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	d, err := DirectiveFactory(json.NewDecoder(bytes.NewBufferString(`{"Prefix":"test_key"}`)).Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Execute(s)
+	if err != ErrInvalidPrefix {
+		t.Fatal(err)
+	}
+	d, err = DirectiveFactory(json.NewDecoder(bytes.NewBufferString(`{"Prefix":"testkey"}`)).Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if MustGetModule(s) != module || module.Prefix != "testkey" {
+		t.Fatal(module)
+	}
+	err = herbsystem.Catch(func() {
+		module.MustList("test")
+	})
+	if err != ErrStoreNotSet {
+		t.Fatal(err)
+	}
+	module.Store = NewMemoryStore()
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	key, _ := module.MustIssue("test", "cli", nil, 0)
+	if !strings.HasPrefix(key, "testkey_") {
+		t.Fatal(key)
+	}
+}
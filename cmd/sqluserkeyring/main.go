@@ -0,0 +1,68 @@
+//Command sqluserkeyring re-encrypts sqlusersystem columns with current encryption key.
+//
+//Usage:
+//
+//	sqluserkeyring [flags]
+//
+//Accounts and totp secrets not encrypted by current key are re-encrypted in batches.
+//Records of all tenants are processed.
+//Old keys can be removed from config after command finished.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/providers/herb/statictoml"
+	"github.com/herb-go/usersystem-drivers/sqlusersystem"
+)
+
+//ErrEncryptionNotConfigured error raised when encryption not configured in config file.
+var ErrEncryptionNotConfigured = errors.New("encryption not configured")
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("sqluserkeyring", flag.ContinueOnError)
+	var file string
+	var batch int
+	flags.StringVar(&file, "config", "sqluser.static.toml", "sqlusersystem config file")
+	flags.IntVar(&batch, "batch", 100, "records re-encrypted in every batch")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	c := &sqlusersystem.Config{}
+	err = statictoml.Source(file).Load(c)
+	if err != nil {
+		return err
+	}
+	if c.Encryption == nil {
+		return ErrEncryptionNotConfigured
+	}
+	u := sqlusersystem.New()
+	err = c.ApplyToUser(u)
+	if err != nil {
+		return err
+	}
+	return herbsystem.Catch(func() {
+		if c.TableAccount != "" {
+			fmt.Fprintf(out, "accounts\t%d\n", u.Account().MustReencryptAll(batch))
+		}
+		if c.TableTOTP != "" {
+			fmt.Fprintf(out, "totp\t%d\n", u.TOTP().MustReencryptAll(batch))
+		}
+	})
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,332 @@
+//Command tomluser manages users in tomluser files.
+//
+//Usage:
+//
+//	tomluser [flags] command [arguments]
+//
+//Commands:
+//
+//	list                           list all users
+//	show uid                       show user status,accounts,roles and profile
+//	create uid                     create user
+//	remove uid                     remove user
+//	passwd uid                     set password read from stdin,prompted without echo if stdin is a terminal
+//	ban uid                        ban user
+//	unban uid                      unban user
+//	bind uid keyword account       bind account to user
+//	unbind uid keyword account     unbind account from user
+//	roles uid [role...]            replace user roles
+//	grant uid role...              grant roles to user
+//	revoke uid role...             revoke roles from user
+//	profile uid field [value...]   replace profile field values
+//
+//Profile fields can only be updated if listed in -profilefields flag,
+//or in schema file given by -profileschema flag,in which case values are validated by schema.
+//Schema file is a toml file with ProfileSchema array,for example:
+//
+//	[[ProfileSchema]]
+//	Name = "email"
+//	Type = "email"
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/herb-go/herbsecurity/authorize/role"
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/providers/herb/statictoml"
+	"github.com/herb-go/user"
+	"github.com/herb-go/user/profile"
+	"github.com/herb-go/user/status"
+	"github.com/herb-go/usersystem-drivers/tomluser"
+	"golang.org/x/term"
+)
+
+//ErrUsage error raised when command arguments invalid.
+var ErrUsage = errors.New("invalid arguments")
+
+//ErrProfileFieldNotAllowed error raised when updating profile field not listed in profile fields.
+var ErrProfileFieldNotAllowed = errors.New("profile field not allowed")
+
+type command struct {
+	args int
+	run  func(u *tomluser.Users, args []string, out io.Writer) error
+}
+
+var commands = map[string]*command{
+	"list":    &command{args: 0, run: list},
+	"show":    &command{args: 1, run: show},
+	"create":  &command{args: 1, run: create},
+	"remove":  &command{args: 1, run: remove},
+	"passwd":  &command{args: 1, run: passwd},
+	"ban":     &command{args: 1, run: ban},
+	"unban":   &command{args: 1, run: unban},
+	"bind":    &command{args: 3, run: bind},
+	"unbind":  &command{args: 3, run: unbind},
+	"roles":   &command{args: 1, run: roles},
+	"grant":   &command{args: 2, run: grant},
+	"revoke":  &command{args: 2, run: revoke},
+	"profile": &command{args: 2, run: updateProfile},
+}
+
+var stdin io.Reader = os.Stdin
+
+//readPassword read password from terminal without echo.
+//Password will be read from stdin line if nil.
+var readPassword func() (string, error)
+
+func list(u *tomluser.Users, args []string, out io.Writer) error {
+	uids := u.MustListUsersByStatus("", 0, false, status.StatusNormal, status.StatusBanned)
+	for _, uid := range uids {
+		st, _ := u.MustLoadStatus(uid)
+		label := "normal"
+		if st == status.StatusBanned {
+			label = "banned"
+		}
+		fmt.Fprintf(out, "%s\t%s\n", uid, label)
+	}
+	return nil
+}
+
+func show(u *tomluser.Users, args []string, out io.Writer) error {
+	uid := args[0]
+	return herbsystem.Catch(func() {
+		st, ok := u.MustLoadStatus(uid)
+		if !ok {
+			panic(user.ErrUserNotExists)
+		}
+		fmt.Fprintf(out, "uid:\t%s\n", uid)
+		fmt.Fprintf(out, "banned:\t%t\n", st == status.StatusBanned)
+		for _, v := range *u.MustAccounts(uid) {
+			fmt.Fprintf(out, "account:\t%s\t%s\n", v.Keyword, v.Account)
+		}
+		for _, v := range *u.MustRoles(uid) {
+			fmt.Fprintf(out, "role:\t%s\n", v.Name)
+		}
+		for _, v := range u.MustGetProfile(uid).Data() {
+			fmt.Fprintf(out, "profile:\t%s\t%s\n", v.Name, v.Value)
+		}
+	})
+}
+
+func create(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustCreateStatus(args[0])
+	})
+}
+
+func remove(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustRemoveStatus(args[0])
+	})
+}
+
+//passwd read password from stdin only,
+//password in arguments would be kept in shell history and visible in process list.
+func passwd(u *tomluser.Users, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return ErrUsage
+	}
+	var password string
+	if readPassword != nil {
+		p, err := readPassword()
+		if err != nil {
+			return err
+		}
+		password = p
+	} else {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return ErrUsage
+	}
+	return herbsystem.Catch(func() {
+		u.MustUpdatePassword(args[0], password)
+	})
+}
+
+func ban(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustUpdateStatus(args[0], status.StatusBanned)
+	})
+}
+
+func unban(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustUpdateStatus(args[0], status.StatusNormal)
+	})
+}
+
+func newAccount(keyword string, account string) *user.Account {
+	a := user.NewAccount()
+	a.Keyword = keyword
+	a.Account = account
+	return a
+}
+
+func bind(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustBindAccount(args[0], newAccount(args[1], args[2]))
+	})
+}
+
+func unbind(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustUnbindAccount(args[0], newAccount(args[1], args[2]))
+	})
+}
+
+func newRoles(names []string) []*role.Role {
+	result := make([]*role.Role, len(names))
+	for k := range names {
+		result[k] = role.NewRole(names[k])
+	}
+	return result
+}
+
+func roles(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustReplaceRoles(args[0], role.NewRoles(newRoles(args[1:])...))
+	})
+}
+
+func grant(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustGrantRoles(args[0], newRoles(args[1:])...)
+	})
+}
+
+func revoke(u *tomluser.Users, args []string, out io.Writer) error {
+	return herbsystem.Catch(func() {
+		u.MustRevokeRoles(args[0], args[1:]...)
+	})
+}
+
+func profileFieldAllowed(u *tomluser.Users, field string) bool {
+	if u.ProfileSchema != nil {
+		return u.ProfileSchema[field] != nil
+	}
+	return u.ProfileFields[field]
+}
+
+func updateProfile(u *tomluser.Users, args []string, out io.Writer) error {
+	uid := args[0]
+	field := args[1]
+	return herbsystem.Catch(func() {
+		current := u.MustGetProfile(uid)
+		//Fields not allowed will be dropped by updating,so they should not be kept silently.
+		if !profileFieldAllowed(u, field) {
+			panic(fmt.Errorf("%w (%s)", ErrProfileFieldNotAllowed, field))
+		}
+		p := profile.NewProfile()
+		for _, v := range current.Data() {
+			if v.Name == field {
+				continue
+			}
+			if !profileFieldAllowed(u, v.Name) {
+				panic(fmt.Errorf("%w (%s)", ErrProfileFieldNotAllowed, v.Name))
+			}
+			p.WithFields(v)
+		}
+		for _, v := range args[2:] {
+			p.With(field, v)
+		}
+		u.MustUpdateProfile(uid, p)
+	})
+}
+
+type profileSchemaFile struct {
+	ProfileSchema []*tomluser.ProfileField
+}
+
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, "Usage: tomluser [flags] command [arguments]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(out, "  %s\n\nFlags:\n", strings.Join(names, " "))
+	flags.PrintDefaults()
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("tomluser", flag.ContinueOnError)
+	c := &tomluser.Config{}
+	var file string
+	flags.StringVar(&file, "file", "users.static.toml", "users file,or users directory in directory mode")
+	flags.StringVar(&c.Format, "format", "", "file format,toml,json or yaml.Detected by file extension if empty")
+	flags.BoolVar(&c.Directory, "dir", false, "directory mode,one file per user")
+	flags.StringVar(&c.HashMode, "hashmode", "", "password hash mode,sha256 if empty")
+	flags.BoolVar(&c.StrictHash, "strict", true, "raise error instead of storing plaintext password if hash mode unknown")
+	flags.IntVar(&c.Backups, "backups", 0, "number of rotating backups kept when saving")
+	var profilefields string
+	flags.StringVar(&profilefields, "profilefields", "", "comma separated profile fields which can be updated")
+	var profileschema string
+	flags.StringVar(&profileschema, "profileschema", "", "toml file of profile field schemas,overrides -profilefields")
+	flags.Usage = func() {
+		usage(flags)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ErrUsage
+	}
+	cmd := commands[flags.Arg(0)]
+	if cmd == nil || flags.NArg()-1 < cmd.args {
+		flags.Usage()
+		return ErrUsage
+	}
+	c.Source = statictoml.Source(file)
+	if profilefields != "" {
+		c.ProfileFields = strings.Split(profilefields, ",")
+	}
+	if profileschema != "" {
+		schema := &profileSchemaFile{}
+		err = statictoml.Source(profileschema).Load(schema)
+		if err != nil {
+			return err
+		}
+		c.ProfileSchema = schema.ProfileSchema
+	}
+	u, err := c.Load()
+	if err != nil {
+		return err
+	}
+	defer tomluser.Release(u)
+	return cmd.run(u, flags.Args()[1:], out)
+}
+
+func main() {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		readPassword = func() (string, error) {
+			fmt.Fprint(os.Stderr, "Password: ")
+			data, err := term.ReadPassword(fd)
+			fmt.Fprintln(os.Stderr)
+			return string(data), err
+		}
+	}
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/herb-go/providers/herb/statictoml"
+	"github.com/herb-go/user"
+	"github.com/herb-go/usersystem-drivers/tomluser"
+)
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "users.static.toml")
+	err = ioutil.WriteFile(file, []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := func(args ...string) (string, error) {
+		out := bytes.NewBuffer(nil)
+		err := run(append([]string{"-file", file, "-profilefields", "email,phone"}, args...), out)
+		return out.String(), err
+	}
+	stdin = strings.NewReader("password\n")
+	for _, args := range [][]string{
+		{"create", "test"},
+		{"passwd", "test"},
+		{"bind", "test", "name", "test"},
+		{"grant", "test", "role1", "role2"},
+		{"revoke", "test", "role1"},
+		{"profile", "test", "email", "test@example.com"},
+		{"create", "banned"},
+		{"ban", "banned"},
+	} {
+		_, err = exec(args...)
+		if err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	_, err = exec("create", "test")
+	if err != user.ErrUserExists {
+		t.Fatal(err)
+	}
+	_, err = exec("bind")
+	if err != ErrUsage {
+		t.Fatal(err)
+	}
+	_, err = exec("passwd", "test", "password")
+	if err != ErrUsage {
+		t.Fatal(err)
+	}
+	_, err = exec("profile", "test", "address", "somewhere")
+	if !errors.Is(err, ErrProfileFieldNotAllowed) {
+		t.Fatal(err)
+	}
+	err = run([]string{"-file", file, "-profilefields", "phone", "profile", "test", "phone", "123"}, bytes.NewBuffer(nil))
+	if !errors.Is(err, ErrProfileFieldNotAllowed) {
+		t.Fatal(err)
+	}
+	schema := path.Join(dir, "schema.static.toml")
+	err = ioutil.WriteFile(schema, []byte("[[ProfileSchema]]\nName=\"email\"\nType=\"email\"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execSchema := func(args ...string) error {
+		return run(append([]string{"-file", file, "-profileschema", schema}, args...), bytes.NewBuffer(nil))
+	}
+	err = execSchema("profile", "test", "phone", "123")
+	if !errors.Is(err, ErrProfileFieldNotAllowed) {
+		t.Fatal(err)
+	}
+	var profileerr *tomluser.ProfileError
+	err = execSchema("profile", "test", "email", "notanemail")
+	if !errors.As(err, &profileerr) || profileerr.Field != "email" {
+		t.Fatal(err)
+	}
+	err = execSchema("profile", "test", "email", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run([]string{"-file", file, "-profileschema", path.Join(dir, "notexist.toml"), "list"}, bytes.NewBuffer(nil))
+	if err == nil {
+		t.Fatal(err)
+	}
+	stdin = strings.NewReader("newpassword\n")
+	_, err = exec("passwd", "banned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readPassword = func() (string, error) {
+		return "terminalpassword", nil
+	}
+	_, err = exec("passwd", "test")
+	readPassword = nil
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := (&tomluser.Config{Source: statictoml.Source(file)}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := u.MustVerifyPassword("test", "terminalpassword")
+	tomluser.Release(u)
+	if !ok {
+		t.Fatal(ok)
+	}
+	out, err := exec("list")
+	if err != nil || out != "banned\tbanned\ntest\tnormal\n" {
+		t.Fatal(out, err)
+	}
+	out, err = exec("show", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"account:\tname\ttest", "role:\trole2", "profile:\temail\ttest@example.com"} {
+		if !strings.Contains(out, v) {
+			t.Fatal(out)
+		}
+	}
+	if strings.Contains(out, "role1") {
+		t.Fatal(out)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil || strings.Contains(string(data), "newpassword") || strings.Contains(string(data), "terminalpassword") || strings.Contains(string(data), "\"password\"") {
+		t.Fatal(string(data), err)
+	}
+	for _, args := range [][]string{
+		{"unban", "banned"},
+		{"unbind", "test", "name", "test"},
+		{"roles", "test", "role3", "role4"},
+		{"profile", "test", "phone", "123"},
+	} {
+		_, err = exec(args...)
+		if err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	out, err = exec("list")
+	if err != nil || out != "banned\tnormal\ntest\tnormal\n" {
+		t.Fatal(out, err)
+	}
+	out, err = exec("show", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"role:\trole3", "role:\trole4", "profile:\temail\ttest@example.com", "profile:\tphone\t123"} {
+		if !strings.Contains(out, v) {
+			t.Fatal(out)
+		}
+	}
+	if strings.Contains(out, "account:") || strings.Contains(out, "role2") {
+		t.Fatal(out)
+	}
+	_, err = exec("unbind", "test", "name", "test")
+	if err != user.ErrAccountUnbindingNotExists {
+		t.Fatal(err)
+	}
+	_, err = exec("roles", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = exec("show", "test")
+	if err != nil || strings.Contains(out, "role:") {
+		t.Fatal(out, err)
+	}
+	_, err = exec("remove", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = exec("list")
+	if err != nil || out != "banned\tnormal\n" {
+		t.Fatal(out, err)
+	}
+	_, err = exec("remove", "test")
+	if err != user.ErrUserNotExists {
+		t.Fatal(err)
+	}
+}
@@ -1,13 +1,23 @@
 package ldapusersystem
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/herb-go/user"
 
 	"gopkg.in/ldap.v2"
 )
 
+//ErrAmbiguousUser error raised when more than one user found by search filter.
+var ErrAmbiguousUser = errors.New("ldapusersystem:more than one user found")
+
+//ErrEmptyPassword error raised when binding user with empty password.
+var ErrEmptyPassword = errors.New("ldapusersystem:empty password")
+
 //Config ldap user config struct
 // example:
 // Net:          "tcp",
@@ -31,31 +41,212 @@ type Config struct {
 	GroupDN      string
 	GroupIDField string
 	GroupFilter  string
+	//PoolSize max admin bound connections kept in pool.
+	//Connections will not be pooled if zero.
+	PoolSize int
+	//PoolIdleTimeoutInSecond idle timeout of pooled connections in second.
+	//DefaultPoolIdleTimeout will be used if zero.
+	PoolIdleTimeoutInSecond int64
+	//PoolCheckIntervalInSecond pooled connections idle longer than interval will be checked before reusing.
+	//DefaultPoolCheckInterval will be used if zero.
+	PoolCheckIntervalInSecond int64
+	//PoolWaitTimeoutInSecond max time to wait for free pooled connection in second.
+	//DefaultPoolWaitTimeout will be used if zero.
+	PoolWaitTimeoutInSecond int64
+	//TLS tls mode,empty for plain ldap,"ldaps" or "starttls".
+	TLS string
+	//TLSCAFile pem encoded ca bundle file used to verify server certificate.
+	//System roots will be used if empty.
+	TLSCAFile string
+	//TLSCertFile pem encoded client certificate file.
+	TLSCertFile string
+	//TLSKeyFile pem encoded client key file.
+	TLSKeyFile string
+	//TLSServerName server name used to verify server certificate.
+	//Host of Addr will be used if empty.
+	TLSServerName string
+	//TLSMinVersion min tls version,"1.0","1.1","1.2" or "1.3".
+	//DefaultTLSMinVersion will be used if empty.
+	TLSMinVersion string
+	//TLSInsecureSkipVerify whether skip server certificate verification.
+	//Should only be used in test.
+	TLSInsecureSkipVerify bool
+	//SearchScope scope of user search,"base","one" or "sub".
+	//"one" will be used if empty.
+	SearchScope string
+	//GroupScope scope of group search,"base","one" or "sub".
+	//"one" will be used if empty.
+	GroupScope string
+	//NestedGroups nested groups mode,empty for direct membership only,"recursive" or "inchain".
+	NestedGroups string
+	//NestedGroupDepth max depth of recursive group resolution.
+	//DefaultNestedGroupDepth will be used if zero.
+	NestedGroupDepth int
+	//GroupMemberField group member field used in "inchain" mode.
+	//DefaultGroupMemberField will be used if empty.
+	GroupMemberField string
+	//SearchBind whether resolve user dn by searching SearchFilter with admin account before binding.
+	//User dn will be created by UserPattern if false.
+	SearchBind bool
+	pool       *Pool
+	poolRefs   int
+	poolLocker sync.Mutex
+	tls        *tls.Config
+	tlsLocker  sync.Mutex
 }
 
-//UpdatePassword update user password
-//Return any error if raised
-func (c *Config) UpdatePassword(uid string, password string) error {
-	uid = ldap.EscapeFilter(uid)
-	l, err := c.Dial()
+//Verify verify search scopes and nested groups mode in config.
+//Return any error if raised.
+func (c *Config) Verify() error {
+	_, err := ParseSearchScope(c.SearchScope)
+	if err != nil {
+		return err
+	}
+	_, err = ParseSearchScope(c.GroupScope)
+	if err != nil {
+		return err
+	}
+	switch c.NestedGroups {
+	case NestedGroupsNone, NestedGroupsRecursive, NestedGroupsInChain:
+		return nil
+	}
+	return fmt.Errorf("%w (%s)", ErrUnknownNestedGroupsMode, c.NestedGroups)
+}
+
+//StartPool start admin connection pool if PoolSize is positive.
+//Every call should be paired with a StopPool call.
+func (c *Config) StartPool() {
+	c.poolLocker.Lock()
+	defer c.poolLocker.Unlock()
+	c.poolRefs++
+	if c.PoolSize <= 0 || c.pool != nil {
+		return
+	}
+	idletimeout := time.Duration(c.PoolIdleTimeoutInSecond) * time.Second
+	if idletimeout <= 0 {
+		idletimeout = DefaultPoolIdleTimeout
+	}
+	checkinterval := time.Duration(c.PoolCheckIntervalInSecond) * time.Second
+	if checkinterval <= 0 {
+		checkinterval = DefaultPoolCheckInterval
+	}
+	c.pool = NewPool(c.PoolSize, c.DialBound, idletimeout, checkinterval)
+	c.pool.WaitTimeout = time.Duration(c.PoolWaitTimeoutInSecond) * time.Second
+	if c.pool.WaitTimeout <= 0 {
+		c.pool.WaitTimeout = DefaultPoolWaitTimeout
+	}
+}
+
+//StopPool close admin connection pool after all StartPool calls stopped.
+func (c *Config) StopPool() {
+	c.poolLocker.Lock()
+	defer c.poolLocker.Unlock()
+	if c.poolRefs > 0 {
+		c.poolRefs--
+	}
+	if c.poolRefs > 0 {
+		return
+	}
+	if c.pool != nil {
+		c.pool.Close()
+		c.pool = nil
+	}
+}
+
+//WithAdmin run given function with admin bound connection.
+//Pooled connection will be used if pool started,
+//otherwise a new connection will be dialed and closed after function returned.
+func (c *Config) WithAdmin(f func(l *ldap.Conn) error) error {
+	c.poolLocker.Lock()
+	pool := c.pool
+	c.poolLocker.Unlock()
+	if pool != nil {
+		return pool.Do(f)
+	}
+	l, err := c.DialBound()
 	if err != nil {
 		return err
 	}
 	defer l.Close()
+	return f(l)
+}
 
-	err = l.Bind(c.BindDN, c.BindPass)
+func (c *Config) userDN(l *ldap.Conn, id string) (string, error) {
+	id = ldap.EscapeFilter(id)
+	if !c.SearchBind {
+		return fmt.Sprintf(c.UserPattern, id), nil
+	}
+	scope, err := ParseSearchScope(c.SearchScope)
+	if err != nil {
+		return "", err
+	}
+	searchRequest := ldap.NewSearchRequest(
+		c.SearchDN,
+		scope,
+		ldap.NeverDerefAliases,
+		2,
+		0,
+		false,
+		fmt.Sprintf(c.SearchFilter, id),
+		[]string{"dn"},
+		nil)
+	result, err := l.Search(searchRequest)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return "", fmt.Errorf("%w (%s)", ErrAmbiguousUser, id)
+	}
 	if err != nil {
+		return "", err
+	}
+	if len(result.Entries) == 0 {
+		return "", user.ErrUserNotExists
+	}
+	if len(result.Entries) > 1 {
+		return "", fmt.Errorf("%w (%s)", ErrAmbiguousUser, id)
+	}
+	return result.Entries[0].DN, nil
+}
+
+//UserDN return dn of given user id.
+//User dn will be searched with admin account if SearchBind is true.
+//Return dn and any error if raised.
+func (c *Config) UserDN(id string) (string, error) {
+	if !c.SearchBind {
+		return c.userDN(nil, id)
+	}
+	var dn string
+	err := c.WithAdmin(func(l *ldap.Conn) error {
+		var err error
+		dn, err = c.userDN(l, id)
 		return err
+	})
+	if err != nil {
+		return "", err
 	}
-	passwordModifyRequest := ldap.NewPasswordModifyRequest(fmt.Sprintf(c.UserPattern, uid), "", password)
-	_, err = l.PasswordModify(passwordModifyRequest)
-	return err
+	return dn, nil
+}
+
+//UpdatePassword update user password
+//Return any error if raised
+func (c *Config) UpdatePassword(uid string, password string) error {
+	return c.WithAdmin(func(l *ldap.Conn) error {
+		dn, err := c.userDN(l, uid)
+		if err != nil {
+			return err
+		}
+		passwordModifyRequest := ldap.NewPasswordModifyRequest(dn, "", password)
+		_, err = l.PasswordModify(passwordModifyRequest)
+		return err
+	})
 }
 func (c *Config) search(l *ldap.Conn, id string, fields ...string) (map[string][]string, error) {
 	id = ldap.EscapeFilter(id)
+	scope, err := ParseSearchScope(c.SearchScope)
+	if err != nil {
+		return nil, err
+	}
 	searchRequest := ldap.NewSearchRequest(
 		c.SearchDN,
-		ldap.ScopeSingleLevel,
+		scope,
 		ldap.NeverDerefAliases,
 		0,
 		0,
@@ -78,49 +269,117 @@ func (c *Config) search(l *ldap.Conn, id string, fields ...string) (map[string][
 	return data, nil
 }
 func (c *Config) SearchUser(id string, fields ...string) (map[string][]string, error) {
-	l, err := c.DialBound()
+	var data map[string][]string
+	err := c.WithAdmin(func(l *ldap.Conn) error {
+		var err error
+		data, err = c.search(l, id, fields...)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer l.Close()
-	return c.search(l, id, fields...)
+	return data, nil
 }
 
-func (c *Config) SearchUserGroups(id string) ([]string, error) {
-	id = ldap.EscapeFilter(id)
-
-	l, err := c.DialBound()
-	if err != nil {
-		return nil, err
-	}
-	uid := fmt.Sprintf(c.UserPattern, id)
+func (c *Config) searchGroups(l *ldap.Conn, scope int, filter string) ([]*ldap.Entry, error) {
 	searchRequest := ldap.NewSearchRequest(
 		c.GroupDN,
-		ldap.ScopeSingleLevel,
+		scope,
 		ldap.NeverDerefAliases,
 		0,
 		0,
 		false,
-		fmt.Sprintf(c.GroupFilter, uid),
+		filter,
 		[]string{c.GroupIDField},
 		nil)
 	result, err := l.Search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
+	return result.Entries, nil
+}
+
+func (c *Config) SearchUserGroups(id string) ([]string, error) {
+	scope, err := ParseSearchScope(c.GroupScope)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*ldap.Entry
+	err = c.WithAdmin(func(l *ldap.Conn) error {
+		uid, err := c.userDN(l, id)
+		if err != nil {
+			return err
+		}
+		//Searched dn should be escaped before used in filter.
+		if c.SearchBind {
+			uid = ldap.EscapeFilter(uid)
+		}
+		switch c.NestedGroups {
+		case NestedGroupsNone:
+			entries, err = c.searchGroups(l, scope, fmt.Sprintf(c.GroupFilter, uid))
+		case NestedGroupsRecursive:
+			depth := c.NestedGroupDepth
+			if depth <= 0 {
+				depth = DefaultNestedGroupDepth
+			}
+			search := func(filter string) ([]*ldap.Entry, error) {
+				return c.searchGroups(l, scope, filter)
+			}
+			entries, err = ResolveNestedGroups(search, c.GroupFilter, uid, depth)
+		case NestedGroupsInChain:
+			field := c.GroupMemberField
+			if field == "" {
+				field = DefaultGroupMemberField
+			}
+			entries, err = c.searchGroups(l, scope, fmt.Sprintf("(%s:%s:=%s)", field, MatchingRuleInChain, uid))
+		default:
+			err = fmt.Errorf("%w (%s)", ErrUnknownNestedGroupsMode, c.NestedGroups)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 	var data []string
-	resultLen := len(result.Entries)
+	resultLen := len(entries)
 	if resultLen > 0 {
 		data = make([]string, resultLen)
 		for i := 0; i < resultLen; i++ {
-			data[i] = result.Entries[i].GetAttributeValue(c.GroupIDField)
+			data[i] = entries[i].GetAttributeValue(c.GroupIDField)
 		}
 	}
 	return data, nil
 }
 
+//Dial dial new connection with tls mode.
+//Return connection and any error if raised.
 func (c *Config) Dial() (*ldap.Conn, error) {
-	return ldap.Dial(c.Net, c.Addr)
+	switch c.TLS {
+	case TLSModeNone:
+		return ldap.Dial(c.Net, c.Addr)
+	case TLSModeLDAPS:
+		config, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		return ldap.DialTLS(c.Net, c.Addr, config)
+	case TLSModeStartTLS:
+		config, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		l, err := ldap.Dial(c.Net, c.Addr)
+		if err != nil {
+			return nil, err
+		}
+		err = l.StartTLS(config)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("%w (%s)", ErrUnknownTLSMode, c.TLS)
 }
 
 func (c *Config) DialBound() (*ldap.Conn, error) {
@@ -130,16 +389,28 @@ func (c *Config) DialBound() (*ldap.Conn, error) {
 	}
 	err = l.Bind(c.BindDN, c.BindPass)
 	if err != nil {
+		l.Close()
 		return nil, err
 	}
 	return l, nil
 }
 func (c *Config) BindUser(uid, password string) (*ldap.Conn, error) {
-	uid = ldap.EscapeFilter(uid)
+	//Bind with empty password is an unauthenticated bind which always succeeds.
+	if password == "" {
+		return nil, ldap.NewError(ldap.LDAPResultInvalidCredentials, ErrEmptyPassword)
+	}
+	dn, err := c.UserDN(uid)
+	if err != nil {
+		return nil, err
+	}
 	l, err := c.Dial()
 	if err != nil {
 		return nil, err
 	}
-	err = l.Bind(fmt.Sprintf(c.UserPattern, uid), password)
-	return l, err
+	err = l.Bind(dn, password)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
 }
@@ -0,0 +1,82 @@
+package ldapusersystem
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/herb-go/user"
+	"gopkg.in/ldap.v2"
+)
+
+func TestSearchBind(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := &Config{
+		Net:          "tcp",
+		Addr:         server.Addr,
+		UserPattern:  testUserPattern,
+		BindDN:       "cn=admin,dc=example",
+		BindPass:     "adminpass",
+		SearchDN:     "dc=example",
+		SearchFilter: "(mail=%s)",
+		SearchScope:  SearchScopeSubtree,
+		SearchBind:   true,
+	}
+	dn, err := c.UserDN("staff@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dn != "uid=staff,ou=Staff,dc=example" {
+		t.Fatal(dn)
+	}
+	l, err := c.BindUser("staff@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	_, err = c.BindUser("staff@example.com", "wrongpassword")
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Fatal(err)
+	}
+	_, err = c.BindUser("staff@example.com", "")
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Fatal(err)
+	}
+	_, err = c.BindUser("notexist@example.com", testPassword)
+	if err != user.ErrUserNotExists {
+		t.Fatal(err)
+	}
+	_, err = c.BindUser("dup@example.com", testPassword)
+	if !errors.Is(err, ErrAmbiguousUser) {
+		t.Fatal(err)
+	}
+	s := &Service{LDAP: c}
+	if !s.MustVerifyPassword("staff@example.com", testPassword) {
+		t.Fatal()
+	}
+	if s.MustVerifyPassword("staff@example.com", "wrongpassword") {
+		t.Fatal()
+	}
+	if s.MustVerifyPassword("notexist@example.com", testPassword) {
+		t.Fatal()
+	}
+	if s.MustVerifyPassword("dup@example.com", testPassword) {
+		t.Fatal()
+	}
+	c.PoolSize = 1
+	c.StartPool()
+	defer c.StopPool()
+	l, err = c.BindUser("staff@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	c.SearchBind = false
+	dn, err = c.UserDN("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dn != testUserDN {
+		t.Fatal(dn)
+	}
+}
@@ -0,0 +1,92 @@
+package ldapusersystem
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/ldap.v2"
+)
+
+//Search scopes
+const (
+	SearchScopeBase        = "base"
+	SearchScopeSingleLevel = "one"
+	SearchScopeSubtree     = "sub"
+)
+
+//SearchScopes ldap search scopes by config name.
+var SearchScopes = map[string]int{
+	SearchScopeBase:        ldap.ScopeBaseObject,
+	SearchScopeSingleLevel: ldap.ScopeSingleLevel,
+	SearchScopeSubtree:     ldap.ScopeWholeSubtree,
+}
+
+//Nested groups modes
+const (
+	//NestedGroupsNone only direct group membership will be resolved.
+	NestedGroupsNone = ""
+	//NestedGroupsRecursive groups of groups will be resolved by recursive searching.
+	NestedGroupsRecursive = "recursive"
+	//NestedGroupsInChain groups of groups will be resolved by server with LDAP_MATCHING_RULE_IN_CHAIN.
+	//Only supported by Active Directory.
+	NestedGroupsInChain = "inchain"
+)
+
+//MatchingRuleInChain oid of active directory LDAP_MATCHING_RULE_IN_CHAIN.
+const MatchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+//DefaultGroupMemberField default group member field used by NestedGroupsInChain mode.
+var DefaultGroupMemberField = "member"
+
+//DefaultNestedGroupDepth default max depth of recursive group resolution.
+var DefaultNestedGroupDepth = 10
+
+//ErrUnknownSearchScope error raised when search scope unknown.
+var ErrUnknownSearchScope = errors.New("ldapusersystem:unknown search scope")
+
+//ErrUnknownNestedGroupsMode error raised when nested groups mode unknown.
+var ErrUnknownNestedGroupsMode = errors.New("ldapusersystem:unknown nested groups mode")
+
+//ParseSearchScope parse search scope by given name.
+//ldap.ScopeSingleLevel will be returned if name is empty.
+//Return scope and any error if raised.
+func ParseSearchScope(name string) (int, error) {
+	if name == "" {
+		return ldap.ScopeSingleLevel, nil
+	}
+	scope, ok := SearchScopes[name]
+	if !ok {
+		return 0, fmt.Errorf("%w (%s)", ErrUnknownSearchScope, name)
+	}
+	return scope, nil
+}
+
+//ResolveNestedGroups resolve groups of given dn and groups of these groups recursively.
+//Search should return groups which have given escaped dn as member.
+//Groups already resolved will be skipped to avoid cycles,
+//and groups deeper than depth will be ignored.
+//Return group entries and any error if raised.
+func ResolveNestedGroups(search func(filter string) ([]*ldap.Entry, error), filter string, dn string, depth int) ([]*ldap.Entry, error) {
+	var result []*ldap.Entry
+	visited := map[string]bool{dn: true}
+	current := []string{dn}
+	for level := 0; level < depth && len(current) > 0; level++ {
+		var next []string
+		for _, member := range current {
+			entries, err := search(fmt.Sprintf(filter, member))
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if visited[entry.DN] {
+					continue
+				}
+				visited[entry.DN] = true
+				result = append(result, entry)
+				next = append(next, ldap.EscapeFilter(entry.DN))
+			}
+		}
+		current = next
+	}
+	return result, nil
+}
@@ -0,0 +1,180 @@
+package ldapusersystem
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/herb-go/usersystem"
+	"gopkg.in/ldap.v2"
+)
+
+func newTestGroupSearch(members map[string][]string) func(filter string) ([]*ldap.Entry, error) {
+	return func(filter string) ([]*ldap.Entry, error) {
+		var result []*ldap.Entry
+		for group, groupmembers := range members {
+			for _, member := range groupmembers {
+				if filter == fmt.Sprintf("(member=%s)", ldap.EscapeFilter(member)) {
+					result = append(result, ldap.NewEntry(group, map[string][]string{"cn": []string{group}}))
+				}
+			}
+		}
+		return result, nil
+	}
+}
+
+func TestResolveNestedGroups(t *testing.T) {
+	search := newTestGroupSearch(map[string][]string{
+		"cn=group1": []string{"uid=test"},
+		"cn=group2": []string{"cn=group1"},
+		"cn=group3": []string{"cn=group2", "uid=test"},
+		"cn=group4": []string{"cn=group3"},
+		"cn=group5": []string{"cn=group4"},
+		"cn=group6": []string{"uid=other"},
+	})
+	entries, err := ResolveNestedGroups(search, "(member=%s)", "uid=test", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatal(entries)
+	}
+	entries, err = ResolveNestedGroups(search, "(member=%s)", "uid=test", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatal(entries)
+	}
+	entries, err = ResolveNestedGroups(search, "(member=%s)", "uid=test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal(entries)
+	}
+	cycle := newTestGroupSearch(map[string][]string{
+		"cn=group1": []string{"uid=test", "cn=group2"},
+		"cn=group2": []string{"cn=group1"},
+	})
+	entries, err = ResolveNestedGroups(cycle, "(member=%s)", "uid=test", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal(entries)
+	}
+	entries, err = ResolveNestedGroups(search, "(member=%s)", "uid=notexist", 10)
+	if err != nil || len(entries) != 0 {
+		t.Fatal(entries, err)
+	}
+}
+
+func TestParseSearchScope(t *testing.T) {
+	scope, err := ParseSearchScope("")
+	if err != nil || scope != ldap.ScopeSingleLevel {
+		t.Fatal(scope, err)
+	}
+	scope, err = ParseSearchScope(SearchScopeSubtree)
+	if err != nil || scope != ldap.ScopeWholeSubtree {
+		t.Fatal(scope, err)
+	}
+	_, err = ParseSearchScope("unknown")
+	if !errors.Is(err, ErrUnknownSearchScope) {
+		t.Fatal(err)
+	}
+}
+
+func testGroupsEqual(groups []string, expected ...string) bool {
+	if len(groups) != len(expected) {
+		return false
+	}
+	found := map[string]bool{}
+	for _, v := range groups {
+		found[v] = true
+	}
+	for _, v := range expected {
+		if !found[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearchUserGroups(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestGroupConfig(server.Addr)
+	groups, err := c.SearchUserGroups("test")
+	if err != nil || !testGroupsEqual(groups, "developers") {
+		t.Fatal(groups, err)
+	}
+	c.GroupScope = SearchScopeSubtree
+	groups, err = c.SearchUserGroups("test")
+	if err != nil || !testGroupsEqual(groups, "developers", "staff") {
+		t.Fatal(groups, err)
+	}
+	c.GroupScope = SearchScopeBase
+	groups, err = c.SearchUserGroups("test")
+	if err != nil || len(groups) != 0 {
+		t.Fatal(groups, err)
+	}
+	c.GroupScope = ""
+	c.NestedGroups = NestedGroupsRecursive
+	groups, err = c.SearchUserGroups("test")
+	if err != nil || !testGroupsEqual(groups, "developers", "engineering") {
+		t.Fatal(groups, err)
+	}
+	c.GroupScope = SearchScopeSubtree
+	groups, err = c.SearchUserGroups("test")
+	if err != nil || !testGroupsEqual(groups, "developers", "staff", "engineering") {
+		t.Fatal(groups, err)
+	}
+	c.NestedGroupDepth = 1
+	groups, err = c.SearchUserGroups("test")
+	if err != nil || !testGroupsEqual(groups, "developers", "staff") {
+		t.Fatal(groups, err)
+	}
+	c.GroupScope = ""
+	c.NestedGroupDepth = 0
+	c.NestedGroups = NestedGroupsInChain
+	groups, err = c.SearchUserGroups("test")
+	if err != nil || !testGroupsEqual(groups, "developers", "engineering") {
+		t.Fatal(groups, err)
+	}
+	c.GroupMemberField = "memberOf"
+	groups, err = c.SearchUserGroups("test")
+	if err != nil || len(groups) != 0 {
+		t.Fatal(groups, err)
+	}
+}
+
+func TestVerifyConfig(t *testing.T) {
+	c := &Config{}
+	err := c.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.NestedGroups = "nested"
+	err = c.Verify()
+	if !errors.Is(err, ErrUnknownNestedGroupsMode) {
+		t.Fatal(err)
+	}
+	s := &Service{LDAP: c}
+	err = s.Execute(usersystem.New())
+	if !errors.Is(err, ErrUnknownNestedGroupsMode) {
+		t.Fatal(err)
+	}
+	c.NestedGroups = NestedGroupsInChain
+	c.GroupScope = "subtree"
+	err = c.Verify()
+	if !errors.Is(err, ErrUnknownSearchScope) {
+		t.Fatal(err)
+	}
+	c.GroupScope = ""
+	c.SearchScope = "subtree"
+	err = c.Verify()
+	if !errors.Is(err, ErrUnknownSearchScope) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,216 @@
+package ldapusersystem
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/ldap.v2"
+)
+
+//ErrPoolClosed error raised when getting connection from closed pool.
+var ErrPoolClosed = errors.New("ldapusersystem:pool closed")
+
+//ErrPoolTimeout error raised when waiting for free connection timeout.
+var ErrPoolTimeout = errors.New("ldapusersystem:pool wait timeout")
+
+//DefaultPoolIdleTimeout default idle timeout of pooled connections.
+var DefaultPoolIdleTimeout = 5 * time.Minute
+
+//DefaultPoolCheckInterval default interval to check pooled connections before reusing.
+var DefaultPoolCheckInterval = 30 * time.Second
+
+//DefaultPoolWaitTimeout default max time to wait for free connection.
+var DefaultPoolWaitTimeout = 30 * time.Second
+
+type pooledConn struct {
+	conn     *ldap.Conn
+	lastUsed time.Time
+}
+
+//Pool bounded pool of admin bound ldap connections.
+type Pool struct {
+	//Dial function to dial and bind new connection.
+	Dial func() (*ldap.Conn, error)
+	//IdleTimeout idle connections longer than timeout will be closed.
+	IdleTimeout time.Duration
+	//CheckInterval connections idle longer than interval will be checked before reusing.
+	CheckInterval time.Duration
+	//WaitTimeout max time to wait for free connection if all connections in use.
+	//Caller will wait until connection returned or pool closed if not positive.
+	WaitTimeout time.Duration
+	locker      sync.Mutex
+	idle        []*pooledConn
+	sem         chan struct{}
+	closed      bool
+	stop        chan struct{}
+}
+
+func check(l *ldap.Conn) error {
+	req := ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 5, false, "(objectClass=*)", []string{"1.1"}, nil)
+	_, err := l.Search(req)
+	return err
+}
+
+func (p *Pool) popIdle() *pooledConn {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if len(p.idle) == 0 {
+		return nil
+	}
+	c := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return c
+}
+
+func (p *Pool) acquire() error {
+	p.locker.Lock()
+	closed := p.closed
+	p.locker.Unlock()
+	if closed {
+		return ErrPoolClosed
+	}
+	var timeout <-chan time.Time
+	if p.WaitTimeout > 0 {
+		timer := time.NewTimer(p.WaitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.sem <- struct{}{}:
+		return nil
+	case <-p.stop:
+		return ErrPoolClosed
+	case <-timeout:
+		return ErrPoolTimeout
+	}
+}
+
+//Get get connection from pool.
+//Caller will be blocked until connection returned if all connections in use,
+//ErrPoolTimeout will be returned if waiting longer than WaitTimeout.
+//Idle connections will be health checked and expired connections will be reconnected.
+//Connection must be returned by Put.
+func (p *Pool) Get() (*ldap.Conn, error) {
+	err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		c := p.popIdle()
+		if c == nil {
+			break
+		}
+		idle := time.Since(c.lastUsed)
+		if p.IdleTimeout > 0 && idle > p.IdleTimeout {
+			c.conn.Close()
+			continue
+		}
+		if p.CheckInterval > 0 && idle > p.CheckInterval && check(c.conn) != nil {
+			c.conn.Close()
+			continue
+		}
+		return c.conn, nil
+	}
+	l, err := p.Dial()
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	return l, nil
+}
+
+//Put return connection to pool.
+//Broken connection will be closed instead of reused.
+func (p *Pool) Put(l *ldap.Conn, broken bool) {
+	defer func() {
+		<-p.sem
+	}()
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if broken || p.closed {
+		l.Close()
+		return
+	}
+	p.idle = append(p.idle, &pooledConn{conn: l, lastUsed: time.Now()})
+}
+
+//Do run given function with pooled connection.
+//Connection will be treated as broken if network error returned or function panics.
+func (p *Pool) Do(f func(l *ldap.Conn) error) error {
+	l, err := p.Get()
+	if err != nil {
+		return err
+	}
+	broken := true
+	defer func() {
+		p.Put(l, broken)
+	}()
+	err = f(l)
+	broken = err != nil && ldap.IsErrorWithCode(err, ldap.ErrorNetwork)
+	return err
+}
+
+//CloseIdle close connections idle longer than idle timeout.
+func (p *Pool) CloseIdle() {
+	if p.IdleTimeout <= 0 {
+		return
+	}
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	idle := make([]*pooledConn, 0, len(p.idle))
+	for _, c := range p.idle {
+		if time.Since(c.lastUsed) > p.IdleTimeout {
+			c.conn.Close()
+			continue
+		}
+		idle = append(idle, c)
+	}
+	p.idle = idle
+}
+
+func (p *Pool) reap(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.CloseIdle()
+		}
+	}
+}
+
+//Close close pool and all idle connections.
+//Callers waiting for free connection will get ErrPoolClosed.
+//Connections in use will be closed when returned.
+func (p *Pool) Close() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	for _, c := range p.idle {
+		c.conn.Close()
+	}
+	p.idle = nil
+}
+
+//NewPool create new pool with given max connections and dial function.
+//Idle connections will be closed in background if idle timeout is positive.
+func NewPool(size int, dial func() (*ldap.Conn, error), idletimeout time.Duration, checkinterval time.Duration) *Pool {
+	p := &Pool{
+		Dial:          dial,
+		IdleTimeout:   idletimeout,
+		CheckInterval: checkinterval,
+		sem:           make(chan struct{}, size),
+		stop:          make(chan struct{}),
+	}
+	if idletimeout > 0 {
+		go p.reap(idletimeout/2, p.stop)
+	}
+	return p
+}
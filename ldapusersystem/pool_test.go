@@ -0,0 +1,279 @@
+package ldapusersystem
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/user"
+	"gopkg.in/ldap.v2"
+)
+
+func newTestPoolConfig(addr string) *Config {
+	return &Config{
+		Net:          "tcp",
+		Addr:         addr,
+		UserPattern:  testUserPattern,
+		BindDN:       "cn=admin,dc=example",
+		BindPass:     "adminpass",
+		SearchDN:     "dc=example",
+		SearchFilter: "(mail=%s)",
+		SearchScope:  SearchScopeSubtree,
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	p := NewPool(1, c.DialBound, 50*time.Millisecond, 0)
+	defer p.Close()
+	err := p.Do(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Do(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Accepted() != 1 {
+		t.Fatal(server.Accepted())
+	}
+	time.Sleep(200 * time.Millisecond)
+	p.locker.Lock()
+	idle := len(p.idle)
+	p.locker.Unlock()
+	if idle != 0 {
+		t.Fatal(idle)
+	}
+	err = p.Do(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Accepted() != 2 {
+		t.Fatal(server.Accepted())
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	p := NewPool(1, c.DialBound, 0, 10*time.Millisecond)
+	defer p.Close()
+	l, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(l, false)
+	time.Sleep(50 * time.Millisecond)
+	checked, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != l {
+		t.Fatal(checked)
+	}
+	p.Put(checked, false)
+	if server.Accepted() != 1 {
+		t.Fatal(server.Accepted())
+	}
+}
+
+func TestPoolReconnect(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	p := NewPool(1, c.DialBound, 0, 10*time.Millisecond)
+	defer p.Close()
+	l, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(l, false)
+	server.DropConns()
+	time.Sleep(50 * time.Millisecond)
+	reconnected, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconnected == l {
+		t.Fatal(reconnected)
+	}
+	err = check(reconnected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(reconnected, false)
+	if server.Accepted() != 2 {
+		t.Fatal(server.Accepted())
+	}
+}
+
+func TestPoolBrokenConnection(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	p := NewPool(1, c.DialBound, 0, 0)
+	defer p.Close()
+	err := p.Do(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DropConns()
+	time.Sleep(50 * time.Millisecond)
+	err = p.Do(check)
+	if !ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		t.Fatal(err)
+	}
+	p.locker.Lock()
+	idle := len(p.idle)
+	p.locker.Unlock()
+	if idle != 0 {
+		t.Fatal(idle)
+	}
+	err = p.Do(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Accepted() != 2 {
+		t.Fatal(server.Accepted())
+	}
+}
+
+func TestPoolPanic(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	p := NewPool(1, c.DialBound, 0, 0)
+	p.WaitTimeout = time.Second
+	defer p.Close()
+	panicked := errors.New("panicked")
+	for i := 0; i < 2; i++ {
+		err := herbsystem.Catch(func() {
+			p.Do(func(l *ldap.Conn) error {
+				panic(panicked)
+			})
+		})
+		if err != panicked {
+			t.Fatal(err)
+		}
+	}
+	p.locker.Lock()
+	idle := len(p.idle)
+	p.locker.Unlock()
+	if idle != 0 {
+		t.Fatal(idle)
+	}
+	err := p.Do(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Accepted() != 3 {
+		t.Fatal(server.Accepted())
+	}
+}
+
+func TestPoolWaitTimeout(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	p := NewPool(1, c.DialBound, 0, 0)
+	p.WaitTimeout = 50 * time.Millisecond
+	defer p.Close()
+	l, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Get()
+	if err != ErrPoolTimeout {
+		t.Fatal(err)
+	}
+	p.Put(l, false)
+	l, err = p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(l, false)
+}
+
+func TestPoolCloseInUse(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	p := NewPool(1, c.DialBound, 0, 0)
+	l, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := p.Get()
+		waiting <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.Close()
+	select {
+	case err = <-waiting:
+		if err != ErrPoolClosed {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting caller not released")
+	}
+	err = check(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(l, false)
+	err = check(l)
+	if !ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		t.Fatal(err)
+	}
+	_, err = p.Get()
+	if err != ErrPoolClosed {
+		t.Fatal(err)
+	}
+}
+
+func TestServicePool(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	c := newTestPoolConfig(server.Addr)
+	c.PoolSize = 1
+	s := &Service{LDAP: c, ProfileFields: []string{"mail"}}
+	s.Start()
+	s.Start()
+	p := s.MustGetProfile("staff@example.com")
+	if p == nil {
+		t.Fatal(p)
+	}
+	p = s.MustGetProfile("staff@example.com")
+	if p == nil {
+		t.Fatal(p)
+	}
+	if server.Accepted() != 1 {
+		t.Fatal(server.Accepted())
+	}
+	err := herbsystem.Catch(func() {
+		s.MustGetProfile("notexist@example.com")
+	})
+	if err != user.ErrUserNotExists {
+		t.Fatal(err)
+	}
+	s.Stop()
+	c.poolLocker.Lock()
+	pool := c.pool
+	c.poolLocker.Unlock()
+	if pool == nil {
+		t.Fatal(pool)
+	}
+	s.Stop()
+	c.poolLocker.Lock()
+	pool = c.pool
+	c.poolLocker.Unlock()
+	if pool != nil {
+		t.Fatal(pool)
+	}
+}
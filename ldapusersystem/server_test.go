@@ -0,0 +1,282 @@
+package ldapusersystem
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "gopkg.in/asn1-ber.v1"
+	"gopkg.in/ldap.v2"
+)
+
+const testUserPattern = "uid=%s,ou=People,dc=example"
+const testUserDN = "uid=test,ou=People,dc=example"
+const testPassword = "secret"
+
+var testPasswords = map[string]string{
+	testUserDN:                      testPassword,
+	"uid=staff,ou=Staff,dc=example": testPassword,
+	"cn=admin,dc=example":           "adminpass",
+}
+
+type testEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+func newTestGroup(dn string, cn string) *testEntry {
+	return &testEntry{DN: dn, Attributes: map[string][]string{"cn": []string{cn}}}
+}
+
+//testSearchResults entries returned by stand-in by search filter.
+//Entries out of search base and scope will be skipped.
+var testSearchResults = map[string][]*testEntry{
+	"(mail=staff@example.com)": []*testEntry{&testEntry{DN: "uid=staff,ou=Staff,dc=example"}},
+	"(mail=dup@example.com)":   []*testEntry{&testEntry{DN: "uid=dup1,ou=Staff,dc=example"}, &testEntry{DN: "uid=dup2,ou=People,dc=example"}},
+	"(member=" + testUserDN + ")": []*testEntry{
+		newTestGroup("cn=developers,ou=Group,dc=example", "developers"),
+		newTestGroup("cn=staff,ou=Teams,ou=Group,dc=example", "staff"),
+	},
+	"(member=cn=developers,ou=Group,dc=example)": []*testEntry{
+		newTestGroup("cn=engineering,ou=Group,dc=example", "engineering"),
+	},
+	"(member=cn=engineering,ou=Group,dc=example)": []*testEntry{
+		newTestGroup("cn=developers,ou=Group,dc=example", "developers"),
+	},
+	"(member:" + MatchingRuleInChain + ":=" + testUserDN + ")": []*testEntry{
+		newTestGroup("cn=developers,ou=Group,dc=example", "developers"),
+		newTestGroup("cn=engineering,ou=Group,dc=example", "engineering"),
+	},
+}
+
+func testInScope(dn string, base string, scope int64) bool {
+	switch scope {
+	case int64(ldap.ScopeBaseObject):
+		return dn == base
+	case int64(ldap.ScopeSingleLevel):
+		i := strings.Index(dn, ",")
+		return i >= 0 && dn[i+1:] == base
+	}
+	return dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+func newTestCertificate(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func writeTestEntry(conn net.Conn, id int64, entry *testEntry) error {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry.Attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attribute.AppendChild(vals)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	packet.AppendChild(op)
+	_, err := conn.Write(packet.Bytes())
+	return err
+}
+
+func writeTestResponse(conn net.Conn, id int64, tag ber.Tag, code int64) error {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "errorMessage"))
+	packet.AppendChild(op)
+	_, err := conn.Write(packet.Bytes())
+	return err
+}
+
+//serveTestLDAP minimal ldap stand-in which only answers simple bind,search and starttls requests.
+//Search results are looked up by decompiled filter in testSearchResults.
+func serveTestLDAP(conn net.Conn, config *tls.Config) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			if len(op.Children) < 3 {
+				return
+			}
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			dn, _ := op.Children[1].Value.(string)
+			password, ok := testPasswords[dn]
+			if ok && op.Children[2].Data.String() == password {
+				code = ldap.LDAPResultSuccess
+			}
+			if writeTestResponse(conn, id, ldap.ApplicationBindResponse, code) != nil {
+				return
+			}
+		case ldap.ApplicationSearchRequest:
+			if len(op.Children) < 7 {
+				return
+			}
+			base, _ := op.Children[0].Value.(string)
+			scope, _ := op.Children[1].Value.(int64)
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				return
+			}
+			for _, entry := range testSearchResults[filter] {
+				if !testInScope(entry.DN, base, scope) {
+					continue
+				}
+				if writeTestEntry(conn, id, entry) != nil {
+					return
+				}
+			}
+			if writeTestResponse(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess) != nil {
+				return
+			}
+		case ldap.ApplicationExtendedRequest:
+			if writeTestResponse(conn, id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess) != nil {
+				return
+			}
+			tlsconn := tls.Server(conn, config)
+			if tlsconn.Handshake() != nil {
+				return
+			}
+			conn = tlsconn
+		default:
+			return
+		}
+	}
+}
+
+//testLDAPServer in-process ldap stand-in shared by package tests.
+type testLDAPServer struct {
+	Addr     string
+	CAFile   string
+	listener net.Listener
+	dir      string
+	locker   sync.Mutex
+	conns    []net.Conn
+	accepted int
+}
+
+//Accepted return count of accepted connections.
+func (s *testLDAPServer) Accepted() int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.accepted
+}
+
+//DropConns close all accepted connections from server side.
+func (s *testLDAPServer) DropConns() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+//Stop stop server and remove ca file.
+func (s *testLDAPServer) Stop() {
+	s.listener.Close()
+	s.DropConns()
+	os.RemoveAll(s.dir)
+}
+
+func newTestLDAPServer(t *testing.T, ldaps bool) *testLDAPServer {
+	cert, capem := newTestCertificate(t)
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cafile := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(cafile, capem, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ldaps {
+		listener = tls.NewListener(listener, config)
+	}
+	s := &testLDAPServer{
+		Addr:     listener.Addr().String(),
+		CAFile:   cafile,
+		listener: listener,
+		dir:      dir,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.locker.Lock()
+			s.accepted++
+			s.conns = append(s.conns, conn)
+			s.locker.Unlock()
+			go serveTestLDAP(conn, config)
+		}
+	}()
+	return s
+}
+
+func testBind(c *Config) error {
+	l, err := c.BindUser("test", testPassword)
+	if err != nil {
+		return err
+	}
+	l.Close()
+	return nil
+}
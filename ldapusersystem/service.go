@@ -1,10 +1,16 @@
 package ldapusersystem
 
 import (
+	"errors"
+	"log"
+
+	"github.com/herb-go/herbsecurity/authorize/role"
+	"github.com/herb-go/user"
 	"github.com/herb-go/user/profile"
 	"github.com/herb-go/usersystem"
 	"github.com/herb-go/usersystem/modules/userpassword"
 	"github.com/herb-go/usersystem/modules/userprofile"
+	"github.com/herb-go/usersystem/modules/userrole"
 	"gopkg.in/ldap.v2"
 )
 
@@ -12,12 +18,24 @@ type Service struct {
 	LDAP          *Config
 	ProfileFields []string
 	ServePassword bool
+	//ServeRoles whether serve user roles by ldap group membership.
+	ServeRoles bool
+	//RoleMap map from group id to role names.
+	RoleMap map[string][]string
+	//PassthroughGroups whether unmapped group id should be used as role name.
+	PassthroughGroups bool
 }
 
+//MustVerifyPassword verify password of given uid.
+//Ambiguous user id found by search bind will be logged and treated as verification failure.
 func (s *Service) MustVerifyPassword(uid string, password string) bool {
 	l, err := s.LDAP.BindUser(uid, password)
 	if err != nil {
-		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		if err == user.ErrUserNotExists || ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return false
+		}
+		if errors.Is(err, ErrAmbiguousUser) {
+			log.Printf("ldapusersystem: verify password failed: %s", err)
 			return false
 		}
 		panic(err)
@@ -32,18 +50,59 @@ func (s *Service) MustUpdatePassword(uid string, password string) {
 	}
 }
 
+//GroupRoles convert given group ids to roles.
+//Groups not in RoleMap will be ignored unless PassthroughGroups is true.
+func (s *Service) GroupRoles(groups []string) *role.Roles {
+	result := role.Roles{}
+	added := map[string]bool{}
+	add := func(name string) {
+		if name == "" || added[name] {
+			return
+		}
+		added[name] = true
+		result = append(result, role.NewRole(name))
+	}
+	for _, group := range groups {
+		names, ok := s.RoleMap[group]
+		if !ok {
+			if s.PassthroughGroups {
+				add(group)
+			}
+			continue
+		}
+		for _, name := range names {
+			add(name)
+		}
+	}
+	return &result
+}
+
+//MustRoles return roles of given user.
+func (s *Service) MustRoles(uid string) *role.Roles {
+	groups, err := s.LDAP.SearchUserGroups(uid)
+	if err != nil {
+		panic(err)
+	}
+	return s.GroupRoles(groups)
+}
+
 //PasswordChangeable return password changeable
 func (s *Service) PasswordChangeable() bool {
 	return true
 }
 
 //Start start service
+//Admin connection pool will be started if configured.
+//Start will be called once by every module served by service,
+//pool will be closed after all modules stopped.
 func (s *Service) Start() error {
+	s.LDAP.StartPool()
 	return nil
 }
 
 //Stop stop service
 func (s *Service) Stop() error {
+	s.LDAP.StopPool()
 	return nil
 }
 
@@ -55,12 +114,7 @@ func (s *Service) MustGetProfile(id string) *profile.Profile {
 	if len(s.ProfileFields) == 0 {
 		return nil
 	}
-	l, err := s.LDAP.DialBound()
-	if err != nil {
-		panic(err)
-	}
-	defer l.Close()
-	data, err := s.LDAP.search(l, id, s.ProfileFields...)
+	data, err := s.LDAP.SearchUser(id, s.ProfileFields...)
 	if err != nil {
 		panic(err)
 	}
@@ -74,7 +128,14 @@ func (s *Service) MustGetProfile(id string) *profile.Profile {
 }
 func (s *Service) MustUpdateProfile(id string, p *profile.Profile) {
 }
+
+//Execute apply service to user system.
+//Config will be verified before applied.
 func (s *Service) Execute(us *usersystem.UserSystem) error {
+	err := s.LDAP.Verify()
+	if err != nil {
+		return err
+	}
 	if s.ServePassword {
 		up := userpassword.MustGetModule(us)
 		if up != nil {
@@ -82,6 +143,12 @@ func (s *Service) Execute(us *usersystem.UserSystem) error {
 		}
 	}
 
+	if s.ServeRoles {
+		ur := userrole.MustGetModule(us)
+		if ur != nil {
+			ur.Service = s
+		}
+	}
 	if len(s.ProfileFields) != 0 {
 		up := userprofile.MustGetModule(us)
 		if up != nil {
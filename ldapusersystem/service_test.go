@@ -0,0 +1,89 @@
+package ldapusersystem
+
+import (
+	"testing"
+
+	"github.com/herb-go/herbsecurity/authorize/role"
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem/modules/userrole"
+)
+
+func TestGroupRoles(t *testing.T) {
+	s := &Service{
+		RoleMap: map[string][]string{
+			"admins":     []string{"admin", "editor"},
+			"editors":    []string{"editor"},
+			"developers": []string{},
+		},
+	}
+	r := s.GroupRoles([]string{"admins", "editors", "developers", "guests"})
+	if len(*r) != 2 || !r.Contains(role.NewRoles(role.NewRole("admin"), role.NewRole("editor"))) {
+		t.Fatal(r)
+	}
+	s.PassthroughGroups = true
+	r = s.GroupRoles([]string{"editors", "guests", "developers"})
+	if len(*r) != 2 || !r.Contains(role.NewRoles(role.NewRole("editor"), role.NewRole("guests"))) {
+		t.Fatal(r)
+	}
+	r = s.GroupRoles(nil)
+	if len(*r) != 0 {
+		t.Fatal(r)
+	}
+}
+
+func newTestGroupConfig(addr string) *Config {
+	return &Config{
+		Net:          "tcp",
+		Addr:         addr,
+		UserPattern:  testUserPattern,
+		BindDN:       "cn=admin,dc=example",
+		BindPass:     "adminpass",
+		GroupDN:      "ou=Group,dc=example",
+		GroupIDField: "cn",
+		GroupFilter:  "(member=%s)",
+	}
+}
+
+func TestServeRoles(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	s := &Service{
+		LDAP:       newTestGroupConfig(server.Addr),
+		ServeRoles: true,
+		RoleMap: map[string][]string{
+			"developers": []string{"developer"},
+			"staff":      []string{"staff"},
+		},
+	}
+	r := s.MustRoles("test")
+	if len(*r) != 1 || !r.Contains(role.NewRoles(role.NewRole("developer"))) {
+		t.Fatal(r)
+	}
+	r = s.MustRoles("nobody")
+	if len(*r) != 0 {
+		t.Fatal(r)
+	}
+	us := usersystem.New()
+	uroles := userrole.MustNewAndInstallTo(us)
+	herbsystem.MustReady(us)
+	herbsystem.MustConfigure(us)
+	err := s.Execute(us)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uroles.Service != s {
+		t.Fatal(uroles.Service)
+	}
+	herbsystem.MustStart(us)
+	defer herbsystem.MustStop(us)
+	r = uroles.MustRoles("test")
+	if len(*r) != 1 || !r.Contains(role.NewRoles(role.NewRole("developer"))) {
+		t.Fatal(r)
+	}
+	s.LDAP.GroupScope = SearchScopeSubtree
+	r = uroles.MustRoles("test")
+	if len(*r) != 2 || !r.Contains(role.NewRoles(role.NewRole("developer"), role.NewRole("staff"))) {
+		t.Fatal(r)
+	}
+}
@@ -0,0 +1,95 @@
+package ldapusersystem
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+)
+
+//TLS modes
+const (
+	TLSModeNone     = ""
+	TLSModeLDAPS    = "ldaps"
+	TLSModeStartTLS = "starttls"
+)
+
+//ErrUnknownTLSMode error raised when tls mode unknown.
+var ErrUnknownTLSMode = errors.New("ldapusersystem:unknown tls mode")
+
+//ErrUnknownTLSVersion error raised when tls version unknown.
+var ErrUnknownTLSVersion = errors.New("ldapusersystem:unknown tls version")
+
+//ErrInvalidCA error raised when no certificate found in ca file.
+var ErrInvalidCA = errors.New("ldapusersystem:no certificate found in ca file")
+
+//TLSVersions tls versions by config name.
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//DefaultTLSMinVersion default min tls version.
+var DefaultTLSMinVersion = "1.2"
+
+//CreateTLSConfig create tls config by ldap config.
+//Return tls config and any error if raised.
+func (c *Config) CreateTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+		ServerName:         c.TLSServerName,
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.Addr)
+		if err != nil {
+			host = c.Addr
+		}
+		config.ServerName = host
+	}
+	minversion := c.TLSMinVersion
+	if minversion == "" {
+		minversion = DefaultTLSMinVersion
+	}
+	version, ok := TLSVersions[minversion]
+	if !ok {
+		return nil, fmt.Errorf("%w (%s)", ErrUnknownTLSVersion, minversion)
+	}
+	config.MinVersion = version
+	if c.TLSCAFile != "" {
+		data, err := ioutil.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, ErrInvalidCA
+		}
+		config.RootCAs = pool
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	c.tlsLocker.Lock()
+	defer c.tlsLocker.Unlock()
+	if c.tls != nil {
+		return c.tls, nil
+	}
+	config, err := c.CreateTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	c.tls = config
+	return config, nil
+}
@@ -0,0 +1,129 @@
+package ldapusersystem
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"gopkg.in/ldap.v2"
+)
+
+func TestLDAPS(t *testing.T) {
+	server := newTestLDAPServer(t, true)
+	defer server.Stop()
+	addr, cafile := server.Addr, server.CAFile
+	c := &Config{
+		Net:         "tcp",
+		Addr:        addr,
+		UserPattern: testUserPattern,
+		TLS:         TLSModeLDAPS,
+		TLSCAFile:   cafile,
+	}
+	err := testBind(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.BindUser("test", "wrongpassword")
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Fatal(err)
+	}
+	c = &Config{
+		Net:         "tcp",
+		Addr:        addr,
+		UserPattern: testUserPattern,
+		TLS:         TLSModeLDAPS,
+	}
+	err = testBind(c)
+	if err == nil {
+		t.Fatal(err)
+	}
+	c = &Config{
+		Net:                   "tcp",
+		Addr:                  addr,
+		UserPattern:           testUserPattern,
+		TLS:                   TLSModeLDAPS,
+		TLSInsecureSkipVerify: true,
+	}
+	err = testBind(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = &Config{
+		Net:           "tcp",
+		Addr:          addr,
+		UserPattern:   testUserPattern,
+		TLS:           TLSModeLDAPS,
+		TLSCAFile:     cafile,
+		TLSServerName: "ldap.example.com",
+	}
+	err = testBind(c)
+	if err == nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	server := newTestLDAPServer(t, false)
+	defer server.Stop()
+	addr, cafile := server.Addr, server.CAFile
+	c := &Config{
+		Net:         "tcp",
+		Addr:        addr,
+		UserPattern: testUserPattern,
+		TLS:         TLSModeStartTLS,
+		TLSCAFile:   cafile,
+	}
+	err := testBind(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = &Config{
+		Net:         "tcp",
+		Addr:        addr,
+		UserPattern: testUserPattern,
+		TLS:         TLSModeStartTLS,
+	}
+	err = testBind(c)
+	if err == nil {
+		t.Fatal(err)
+	}
+	c = &Config{
+		Net:         "tcp",
+		Addr:        addr,
+		UserPattern: testUserPattern,
+	}
+	err = testBind(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	c := &Config{
+		Addr:          "127.0.0.1:636",
+		TLS:           TLSModeLDAPS,
+		TLSMinVersion: "0.9",
+	}
+	_, err := c.Dial()
+	if !errors.Is(err, ErrUnknownTLSVersion) {
+		t.Fatal(err)
+	}
+	c = &Config{
+		Addr: "127.0.0.1:636",
+		TLS:  "unknown",
+	}
+	_, err = c.Dial()
+	if !errors.Is(err, ErrUnknownTLSMode) {
+		t.Fatal(err)
+	}
+	c = &Config{
+		Addr: "ldap.example.com:636",
+	}
+	config, err := c.CreateTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerName != "ldap.example.com" || config.MinVersion != tls.VersionTLS12 || config.InsecureSkipVerify {
+		t.Fatal(config)
+	}
+}
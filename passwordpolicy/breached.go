@@ -0,0 +1,205 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//ErrInvalidBloomFilter error raised when bloom filter data invalid.
+var ErrInvalidBloomFilter = errors.New("passwordpolicy:invalid bloom filter")
+
+//MaxBloomFilterK max hash functions count of bloom filter.
+const MaxBloomFilterK = 64
+
+//HashPrefixLength length of sha1 hash prefix used to split breached hashes into buckets.
+const HashPrefixLength = 5
+
+//BreachedList breached password list interface.
+type BreachedList interface {
+	//Contains check if password in breached list.
+	//Return whether password breached and any error if raised.
+	Contains(password string) (bool, error)
+}
+
+//SHA1Hex return upper case hex encoded sha1 hash of password.
+func SHA1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+//HashList breached password list in k-anonymity style.
+//Sha1 hashes are grouped by 5 characters prefix,only suffixes are stored.
+type HashList struct {
+	buckets map[string]map[string]bool
+}
+
+//Add add sha1 hex hash to list.
+func (l *HashList) Add(hash string) {
+	hash = strings.ToUpper(strings.TrimSpace(hash))
+	if len(hash) <= HashPrefixLength {
+		return
+	}
+	prefix := hash[:HashPrefixLength]
+	bucket := l.buckets[prefix]
+	if bucket == nil {
+		bucket = map[string]bool{}
+		l.buckets[prefix] = bucket
+	}
+	bucket[hash[HashPrefixLength:]] = true
+}
+
+//Range return hash suffixes with given 5 characters prefix.
+func (l *HashList) Range(prefix string) []string {
+	bucket := l.buckets[strings.ToUpper(prefix)]
+	result := make([]string, 0, len(bucket))
+	for k := range bucket {
+		result = append(result, k)
+	}
+	return result
+}
+
+//Contains check if password in breached list.
+func (l *HashList) Contains(password string) (bool, error) {
+	hash := SHA1Hex(password)
+	return l.buckets[hash[:HashPrefixLength]][hash[HashPrefixLength:]], nil
+}
+
+//NewHashList create new hash list.
+func NewHashList() *HashList {
+	return &HashList{
+		buckets: map[string]map[string]bool{},
+	}
+}
+
+//ReadHashList read hash list from reader.
+//Each line should be a sha1 hex hash,optionally followed by ":count".
+//Empty lines and lines start with "#" are ignored.
+func ReadHashList(r io.Reader) (*HashList, error) {
+	l := NewHashList()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, ":"); i >= 0 {
+			line = line[:i]
+		}
+		l.Add(line)
+	}
+	return l, scanner.Err()
+}
+
+//LoadHashList load hash list from given file.
+func LoadHashList(path string) (*HashList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadHashList(f)
+}
+
+//BloomFilter breached password bloom filter.
+//False positive is possible,false negative is not.
+type BloomFilter struct {
+	//K hash functions count.
+	K uint32
+	//Bits filter bits.
+	Bits []byte
+}
+
+func (f *BloomFilter) locations(password string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(password))
+	h1 := h.Sum64()
+	h = fnv.New64()
+	h.Write([]byte(password))
+	h2 := h.Sum64()
+	size := uint64(len(f.Bits)) * 8
+	result := make([]uint64, f.K)
+	for i := range result {
+		result[i] = (h1 + uint64(i)*h2) % size
+	}
+	return result
+}
+
+//Add add password to filter.
+func (f *BloomFilter) Add(password string) {
+	for _, v := range f.locations(password) {
+		f.Bits[v/8] |= 1 << (v % 8)
+	}
+}
+
+//Contains check if password may be in filter.
+func (f *BloomFilter) Contains(password string) (bool, error) {
+	for _, v := range f.locations(password) {
+		if f.Bits[v/8]&(1<<(v%8)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+//WriteTo write filter to writer.
+//Data starts with 4 bytes big endian hash functions count,followed by filter bits.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], f.K)
+	n, err := w.Write(header[:])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(f.Bits)
+	return int64(n + m), err
+}
+
+//NewBloomFilter create new bloom filter with given bytes size and hash functions count.
+//Return ErrInvalidBloomFilter if size not positive or k not in range [1,MaxBloomFilterK].
+func NewBloomFilter(size int, k uint32) (*BloomFilter, error) {
+	if size <= 0 || k == 0 || k > MaxBloomFilterK {
+		return nil, ErrInvalidBloomFilter
+	}
+	return &BloomFilter{
+		K:    k,
+		Bits: make([]byte, size),
+	}, nil
+}
+
+//ReadBloomFilter read bloom filter written by BloomFilter.WriteTo.
+//Return ErrInvalidBloomFilter if filter has no bits or hash functions count not in range [1,MaxBloomFilterK].
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= 4 {
+		return nil, ErrInvalidBloomFilter
+	}
+	f := &BloomFilter{
+		K:    binary.BigEndian.Uint32(data[:4]),
+		Bits: data[4:],
+	}
+	if f.K == 0 || f.K > MaxBloomFilterK {
+		return nil, ErrInvalidBloomFilter
+	}
+	return f, nil
+}
+
+//LoadBloomFilter load bloom filter from given file.
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBloomFilter(f)
+}
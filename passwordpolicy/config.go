@@ -0,0 +1,97 @@
+package passwordpolicy
+
+import (
+	"errors"
+
+	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem/modules/useraccount"
+	"github.com/herb-go/usersystem/modules/userpassword"
+)
+
+//ErrUserPasswordServiceNotInstalled error raised when user password service not installed.
+var ErrUserPasswordServiceNotInstalled = errors.New("passwordpolicy:user password service not installed")
+
+//Config password policy directive config.
+//Directive should be executed after password service driver directives.
+type Config struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	MinClasses    int
+	RejectSimilar bool
+	//BreachedHashFile file of breached password sha1 hashes loaded by LoadHashList.
+	BreachedHashFile string
+	//BreachedBloomFile bloom filter file of breached passwords loaded by LoadBloomFilter.
+	//BreachedHashFile will be used if both set.
+	BreachedBloomFile string
+}
+
+//CreatePolicy create password policy by config.
+//Return policy and any error if raised.
+func (c *Config) CreatePolicy() (*Policy, error) {
+	p := &Policy{
+		MinLength:     c.MinLength,
+		RequireUpper:  c.RequireUpper,
+		RequireLower:  c.RequireLower,
+		RequireDigit:  c.RequireDigit,
+		RequireSymbol: c.RequireSymbol,
+		MinClasses:    c.MinClasses,
+		RejectSimilar: c.RejectSimilar,
+	}
+	if c.BreachedHashFile != "" {
+		l, err := LoadHashList(c.BreachedHashFile)
+		if err != nil {
+			return nil, err
+		}
+		p.Breached = l
+	} else if c.BreachedBloomFile != "" {
+		f, err := LoadBloomFilter(c.BreachedBloomFile)
+		if err != nil {
+			return nil, err
+		}
+		p.Breached = f
+	}
+	return p, nil
+}
+
+//Execute wrap installed password service with password policy.
+func (c *Config) Execute(s *usersystem.UserSystem) error {
+	up := userpassword.MustGetModule(s)
+	if up == nil || up.Service == nil {
+		return ErrUserPasswordServiceNotInstalled
+	}
+	p, err := c.CreatePolicy()
+	if err != nil {
+		return err
+	}
+	password := New(up.Service, p)
+	password.Accounts = func(uid string) []string {
+		ua := useraccount.MustGetModule(s)
+		if ua == nil || ua.Service == nil {
+			return nil
+		}
+		accounts := ua.Service.MustAccounts(uid)
+		if accounts == nil {
+			return nil
+		}
+		result := make([]string, 0, len(*accounts))
+		for _, v := range *accounts {
+			result = append(result, v.Account)
+		}
+		return result
+	}
+	up.Service = password
+	return nil
+}
+
+//DirectiveFactory factory to create password policy directive
+var DirectiveFactory = func(loader func(v interface{}) error) (usersystem.Directive, error) {
+	c := &Config{}
+	err := loader(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,42 @@
+package passwordpolicy
+
+import (
+	"github.com/herb-go/usersystem/modules/userpassword"
+)
+
+//Password password service decorator which checks password policy before updating.
+type Password struct {
+	userpassword.Service
+	Policy *Policy
+	//Accounts function to load account names of given uid used in similarity check.
+	//Accounts will not be checked if nil.
+	Accounts func(uid string) []string
+}
+
+//MustCheck check password of given uid.
+//Violations will be raised if password violates policy.
+func (p *Password) MustCheck(uid string, password string) {
+	var accounts []string
+	if p.Policy.RejectSimilar && p.Accounts != nil {
+		accounts = p.Accounts(uid)
+	}
+	err := p.Policy.Check(uid, accounts, password)
+	if err != nil {
+		panic(err)
+	}
+}
+
+//MustUpdatePassword check password policy and update user password.
+//Violations will be raised if password violates policy.
+func (p *Password) MustUpdatePassword(uid string, password string) {
+	p.MustCheck(uid, password)
+	p.Service.MustUpdatePassword(uid, password)
+}
+
+//New create new password service decorator.
+func New(service userpassword.Service, policy *Policy) *Password {
+	return &Password{
+		Service: service,
+		Policy:  policy,
+	}
+}
@@ -0,0 +1,157 @@
+package passwordpolicy
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/providers/herb/statictoml"
+	"github.com/herb-go/user"
+	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/tomluser"
+	"github.com/herb-go/usersystem/modules/useraccount"
+	"github.com/herb-go/usersystem/modules/userpassword"
+	"github.com/herb-go/usersystem/modules/userstatus"
+	"github.com/herb-go/usersystem/usercreate"
+)
+
+func newTestUsersConfig(t *testing.T) (*tomluser.Config, func()) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &tomluser.Config{
+		Source:        source,
+		ServePassword: true,
+		ServeStatus:   true,
+		ServeAccounts: true,
+	}
+	return c, func() {
+		tomluser.Flush()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	c, cleanup := newTestUsersConfig(t)
+	defer cleanup()
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Release(u)
+	u.MustCreateStatus("alice")
+	p := New(u, &Policy{MinLength: 8, RejectSimilar: true})
+	err = herbsystem.Catch(func() {
+		p.MustUpdatePassword("alice", "Bobby12345")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded []string
+	p.Accounts = func(uid string) []string {
+		loaded = append(loaded, uid)
+		return []string{"bobby"}
+	}
+	err = herbsystem.Catch(func() {
+		p.MustUpdatePassword("alice", "short")
+	})
+	if v, ok := err.(Violations); !ok || !v.Has(RuleMinLength) || v.Has(RuleSimilar) {
+		t.Fatal(err)
+	}
+	err = herbsystem.Catch(func() {
+		p.MustUpdatePassword("alice", "Bobby12345")
+	})
+	if v, ok := err.(Violations); !ok || !v.Has(RuleSimilar) {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[0] != "alice" {
+		t.Fatal(loaded)
+	}
+	if !p.MustVerifyPassword("alice", "Bobby12345") || p.MustVerifyPassword("alice", "short") {
+		t.Fatal()
+	}
+	p.MustUpdatePassword("alice", "Correct8Horse")
+	if !u.MustVerifyPassword("alice", "Correct8Horse") {
+		t.Fatal()
+	}
+	p.Policy.RejectSimilar = false
+	p.MustUpdatePassword("alice", "Bobby12345")
+	if len(loaded) != 3 {
+		t.Fatal(loaded)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	uc, cleanup := newTestUsersConfig(t)
+	defer cleanup()
+	c := &Config{
+		MinLength:     8,
+		RejectSimilar: true,
+	}
+	s := usersystem.New()
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	err := c.Execute(s)
+	if err != ErrUserPasswordServiceNotInstalled {
+		t.Fatal(err)
+	}
+	s = usersystem.New()
+	userstatus.MustNewAndInstallTo(s)
+	upassword := userpassword.MustNewAndInstallTo(s)
+	uaccounts := useraccount.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	err = uc.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := upassword.Service.(*Password); !ok {
+		t.Fatal(upassword.Service)
+	}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	usercreate.MustExecCreate(s, "alice")
+	acc := user.NewAccount()
+	acc.Keyword = "name"
+	acc.Account = "bobby"
+	uaccounts.MustBindAccount("alice", acc)
+	err = herbsystem.Catch(func() {
+		upassword.MustUpdatePassword("alice", "Bobby12345")
+	})
+	if v, ok := err.(Violations); !ok || len(v) != 1 || !v.Has(RuleSimilar) {
+		t.Fatal(err)
+	}
+	err = herbsystem.Catch(func() {
+		upassword.MustUpdatePassword("alice", "Alice12345")
+	})
+	if v, ok := err.(Violations); !ok || len(v) != 1 || !v.Has(RuleSimilar) {
+		t.Fatal(err)
+	}
+	err = herbsystem.Catch(func() {
+		upassword.MustUpdatePassword("alice", "short")
+	})
+	if v, ok := err.(Violations); !ok || !v.Has(RuleMinLength) {
+		t.Fatal(err)
+	}
+	upassword.MustUpdatePassword("alice", "Correct8Horse")
+	if !upassword.MustVerifyPassword("alice", "Correct8Horse") {
+		t.Fatal()
+	}
+	c.BreachedHashFile = "notexist"
+	err = c.Execute(s)
+	if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
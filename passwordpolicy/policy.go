@@ -0,0 +1,168 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Violation rules.
+const (
+	RuleMinLength = "minlength"
+	RuleUpper     = "upper"
+	RuleLower     = "lower"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleClasses   = "classes"
+	RuleSimilar   = "similar"
+	RuleBreached  = "breached"
+)
+
+//Violation password policy violation.
+type Violation struct {
+	//Rule violated rule.
+	Rule string
+	//Message human readable message.
+	Message string
+}
+
+//Error return error message.
+func (v *Violation) Error() string {
+	return "passwordpolicy:" + v.Message
+}
+
+//Violations error raised when password violates policy.
+type Violations []*Violation
+
+//Error return error message.
+func (v Violations) Error() string {
+	msgs := make([]string, len(v))
+	for k := range v {
+		msgs[k] = v[k].Message
+	}
+	return "passwordpolicy:" + strings.Join(msgs, ",")
+}
+
+//Has check if given rule violated.
+func (v Violations) Has(rule string) bool {
+	for k := range v {
+		if v[k].Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+//IsViolations check if given error is password policy violations.
+func IsViolations(err error) bool {
+	_, ok := err.(Violations)
+	return ok
+}
+
+//MinSimilarLength min length in runes of uid or account checked in similarity check.
+//Shorter names are ignored,otherwise they would match too many passwords.
+var MinSimilarLength = 3
+
+//Policy password policy
+type Policy struct {
+	//MinLength min password length in runes.
+	//Zero means no limit.
+	MinLength int
+	//RequireUpper whether upper case letter required.
+	RequireUpper bool
+	//RequireLower whether lower case letter required.
+	RequireLower bool
+	//RequireDigit whether digit required.
+	RequireDigit bool
+	//RequireSymbol whether symbol required.
+	RequireSymbol bool
+	//MinClasses min count of character classes in upper,lower,digit and symbol.
+	//Zero means no limit.
+	MinClasses int
+	//RejectSimilar whether reject password which contains uid or account.
+	//Uid and accounts shorter than MinSimilarLength are ignored.
+	RejectSimilar bool
+	//Breached breached password list.
+	//Breached passwords will not be checked if nil.
+	Breached BreachedList
+}
+
+func classes(password string) (upper bool, lower bool, digit bool, symbol bool) {
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsSpace(r):
+		default:
+			symbol = true
+		}
+	}
+	return
+}
+
+func similar(password string, name string) bool {
+	if utf8.RuneCountInString(name) < MinSimilarLength {
+		return false
+	}
+	return strings.Contains(strings.ToLower(password), strings.ToLower(name))
+}
+
+//Check check password of given uid and accounts.
+//Return Violations if password violates policy,or any error if raised.
+func (p *Policy) Check(uid string, accounts []string, password string) error {
+	var result Violations
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		result = append(result, &Violation{Rule: RuleMinLength, Message: fmt.Sprintf("password should have at least %d characters", p.MinLength)})
+	}
+	upper, lower, digit, symbol := classes(password)
+	if p.RequireUpper && !upper {
+		result = append(result, &Violation{Rule: RuleUpper, Message: "password should contain upper case letter"})
+	}
+	if p.RequireLower && !lower {
+		result = append(result, &Violation{Rule: RuleLower, Message: "password should contain lower case letter"})
+	}
+	if p.RequireDigit && !digit {
+		result = append(result, &Violation{Rule: RuleDigit, Message: "password should contain digit"})
+	}
+	if p.RequireSymbol && !symbol {
+		result = append(result, &Violation{Rule: RuleSymbol, Message: "password should contain symbol"})
+	}
+	if p.MinClasses > 0 {
+		var count int
+		for _, v := range []bool{upper, lower, digit, symbol} {
+			if v {
+				count++
+			}
+		}
+		if count < p.MinClasses {
+			result = append(result, &Violation{Rule: RuleClasses, Message: fmt.Sprintf("password should contain at least %d kinds of characters", p.MinClasses)})
+		}
+	}
+	if p.RejectSimilar {
+		names := append([]string{uid}, accounts...)
+		for _, v := range names {
+			if similar(password, v) {
+				result = append(result, &Violation{Rule: RuleSimilar, Message: "password should not be similar to user id or account"})
+				break
+			}
+		}
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			result = append(result, &Violation{Rule: RuleBreached, Message: "password found in breached password list"})
+		}
+	}
+	if len(result) != 0 {
+		return result
+	}
+	return nil
+}
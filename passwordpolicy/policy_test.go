@@ -0,0 +1,111 @@
+package passwordpolicy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	p := &Policy{
+		MinLength:     8,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		MinClasses:    3,
+		RejectSimilar: true,
+	}
+	err := p.Check("uid", []string{"alice"}, "abc")
+	v, ok := err.(Violations)
+	if !ok || !IsViolations(err) {
+		t.Fatal(err)
+	}
+	if !v.Has(RuleMinLength) || !v.Has(RuleUpper) || !v.Has(RuleDigit) || !v.Has(RuleClasses) || v.Has(RuleSimilar) {
+		t.Fatal(v)
+	}
+	err = p.Check("uid", []string{"alice"}, "Alice12345")
+	v, ok = err.(Violations)
+	if !ok || len(v) != 1 || !v.Has(RuleSimilar) {
+		t.Fatal(err)
+	}
+	err = p.Check("uid", []string{"alice"}, "Correct8Horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Check("ab", []string{"al"}, "Abalone12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Check("uid", []string{"Correct8Horse1"}, "Correct8Horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashList(t *testing.T) {
+	data := "# comment\n" + SHA1Hex("password") + ":100\n\n" + strings.ToLower(SHA1Hex("123456")) + "\n"
+	l, err := ReadHashList(bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"password", "123456"} {
+		ok, err := l.Contains(v)
+		if !ok || err != nil {
+			t.Fatal(v, ok, err)
+		}
+	}
+	ok, err := l.Contains("Correct8Horse")
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	hash := SHA1Hex("password")
+	if r := l.Range(hash[:HashPrefixLength]); len(r) != 1 || r[0] != hash[HashPrefixLength:] {
+		t.Fatal(r)
+	}
+	p := &Policy{Breached: l}
+	err = p.Check("uid", nil, "password")
+	if v, ok := err.(Violations); !ok || !v.Has(RuleBreached) {
+		t.Fatal(err)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	f, err := NewBloomFilter(1024, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Add("password")
+	buf := bytes.NewBuffer(nil)
+	_, err = f.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err = ReadBloomFilter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := f.Contains("password")
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	ok, err = f.Contains("Correct8Horse")
+	if ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	_, err = ReadBloomFilter(bytes.NewBufferString("abc"))
+	if err != ErrInvalidBloomFilter {
+		t.Fatal(err)
+	}
+	_, err = ReadBloomFilter(bytes.NewBuffer([]byte{0xff, 0xff, 0xff, 0xff, 0}))
+	if err != ErrInvalidBloomFilter {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		size int
+		k    uint32
+	}{{0, 4}, {1024, 0}, {1024, MaxBloomFilterK + 1}} {
+		_, err = NewBloomFilter(v.size, v.k)
+		if err != ErrInvalidBloomFilter {
+			t.Fatal(v, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package recoverycode
+
+import (
+	"fmt"
+
+	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/storemodule"
+)
+
+//ModuleName recovery code module name.
+const ModuleName = "recoverycode"
+
+//RecoveryCode recovery code usersystem module.
+type RecoveryCode struct {
+	storemodule.Module
+	*Service
+}
+
+//New create new recovery code module.
+func New() *RecoveryCode {
+	r := &RecoveryCode{
+		Service: NewService(),
+	}
+	r.Module = storemodule.New(ModuleName, func() interface{} { return r.Store })
+	return r
+}
+
+//MustNewAndInstallTo create new recovery code module and install to given usersystem.
+func MustNewAndInstallTo(s *usersystem.UserSystem) *RecoveryCode {
+	r := New()
+	storemodule.MustInstallTo(s, r)
+	return r
+}
+
+//MustGetModule get recovery code module installed to given usersystem.
+//Return nil if not installed.
+func MustGetModule(s *usersystem.UserSystem) *RecoveryCode {
+	m := storemodule.MustGetModule(s, ModuleName)
+	if m == nil {
+		return nil
+	}
+	return m.(*RecoveryCode)
+}
+
+//Config recovery code directive config.
+type Config struct {
+	//Count codes generated each time.
+	Count int
+	//Length length of each code.
+	Length int
+}
+
+//Execute apply config to installed recovery code module.
+func (c *Config) Execute(s *usersystem.UserSystem) error {
+	service := MustGetModule(s)
+	if service == nil {
+		return fmt.Errorf("%w (%s)", storemodule.ErrModuleNotInstalled, ModuleName)
+	}
+	if c.Count > 0 {
+		service.Count = c.Count
+	}
+	if c.Length > 0 {
+		service.Length = c.Length
+	}
+	return nil
+}
+
+//DirectiveFactory factory to create recovery code directive
+var DirectiveFactory = func(loader func(v interface{}) error) (usersystem.Directive, error) {
+	c := &Config{}
+	err := loader(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,124 @@
+package recoverycode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+//ErrStoreNotSet error raised when recovery code store not set.
+var ErrStoreNotSet = errors.New("recoverycode:store not set")
+
+//Chars chars used in recovery codes.
+//Ambiguous chars like 0,o,1,l,i are excluded.
+var Chars = "abcdefghjkmnpqrstuvwxyz23456789"
+
+//Store recovery code hashes store interface
+type Store interface {
+	//MustLoadRecoveryCodes load recovery code hashes of given uid.
+	MustLoadRecoveryCodes(uid string) []string
+	//MustReplaceRecoveryCodes replace all recovery code hashes of given uid.
+	MustReplaceRecoveryCodes(uid string, hashes []string)
+	//MustUseRecoveryCode remove given recovery code hash of given uid.
+	//Return whether hash existed.
+	MustUseRecoveryCode(uid string, hash string) bool
+}
+
+//Normalize normalize recovery code input by removing spaces and dashes and converting to lower case.
+func Normalize(code string) string {
+	code = strings.ToLower(code)
+	code = strings.Replace(code, "-", "", -1)
+	return strings.Replace(code, " ", "", -1)
+}
+
+//Hash return hash of normalized recovery code.
+func Hash(code string) string {
+	sum := sha256.Sum256([]byte(Normalize(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+//NewCode create new random recovery code with given length.
+//Code is split into groups of five chars with dash.
+func NewCode(length int) (string, error) {
+	var result = make([]byte, 0, length+length/5)
+	max := big.NewInt(int64(len(Chars)))
+	for i := 0; i < length; i++ {
+		if i > 0 && i%5 == 0 {
+			result = append(result, '-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, Chars[n.Int64()])
+	}
+	return string(result), nil
+}
+
+//Service recovery code service
+type Service struct {
+	//Store recovery code hashes store.
+	Store Store
+	//Count codes count generated in one batch.
+	//default value is 10.
+	Count int
+	//Length code length without dashes.
+	//default value is 10.
+	Length int
+}
+
+func (s *Service) store() Store {
+	if s.Store == nil {
+		panic(ErrStoreNotSet)
+	}
+	return s.Store
+}
+
+//MustGenerate generate new batch of recovery codes for given uid.
+//Previous codes will be invalidated.
+//Only hashes are stored,so returned codes should be shown to user at once.
+func (s *Service) MustGenerate(uid string) []string {
+	codes := make([]string, s.Count)
+	hashes := make([]string, s.Count)
+	for i := 0; i < s.Count; i++ {
+		code, err := NewCode(s.Length)
+		if err != nil {
+			panic(err)
+		}
+		codes[i] = code
+		hashes[i] = Hash(code)
+	}
+	s.store().MustReplaceRecoveryCodes(uid, hashes)
+	return codes
+}
+
+//MustConsume verify and consume recovery code of given uid.
+//Each code can be used only once.
+//Return whether code is valid.
+func (s *Service) MustConsume(uid string, code string) bool {
+	if Normalize(code) == "" {
+		return false
+	}
+	return s.store().MustUseRecoveryCode(uid, Hash(code))
+}
+
+//MustRemaining return remaining recovery codes count of given uid.
+func (s *Service) MustRemaining(uid string) int {
+	return len(s.store().MustLoadRecoveryCodes(uid))
+}
+
+//MustRevoke revoke all recovery codes of given uid.
+func (s *Service) MustRevoke(uid string) {
+	s.store().MustReplaceRecoveryCodes(uid, nil)
+}
+
+//NewService create new recovery code service.
+func NewService() *Service {
+	return &Service{
+		Count:  10,
+		Length: 10,
+	}
+}
@@ -0,0 +1,116 @@
+package recoverycode
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/usersystem"
+)
+
+type testStore struct {
+	locker sync.Mutex
+	data   map[string][]string
+}
+
+func (s *testStore) MustLoadRecoveryCodes(uid string) []string {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return append([]string{}, s.data[uid]...)
+}
+func (s *testStore) MustReplaceRecoveryCodes(uid string, hashes []string) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.data[uid] = append([]string{}, hashes...)
+}
+func (s *testStore) MustUseRecoveryCode(uid string, hash string) bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for k, v := range s.data[uid] {
+		if v == hash {
+			s.data[uid] = append(s.data[uid][:k], s.data[uid][k+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestService(t *testing.T) {
+	s := NewService()
+	s.Store = &testStore{data: map[string][]string{}}
+	uid := "testuid"
+	if s.MustRemaining(uid) != 0 || s.MustConsume(uid, "") {
+		t.Fatal()
+	}
+	codes := s.MustGenerate(uid)
+	if len(codes) != 10 || s.MustRemaining(uid) != 10 {
+		t.Fatal(codes)
+	}
+	if len(codes[0]) != 11 || codes[0][5] != '-' {
+		t.Fatal(codes[0])
+	}
+	if !s.MustConsume(uid, strings.ToUpper(strings.Replace(codes[0], "-", " ", -1))) {
+		t.Fatal()
+	}
+	if s.MustConsume(uid, codes[0]) {
+		t.Fatal()
+	}
+	if s.MustRemaining(uid) != 9 {
+		t.Fatal()
+	}
+	if s.MustConsume("otheruid", codes[1]) {
+		t.Fatal()
+	}
+	newcodes := s.MustGenerate(uid)
+	if s.MustConsume(uid, codes[1]) {
+		t.Fatal()
+	}
+	if !s.MustConsume(uid, newcodes[1]) {
+		t.Fatal()
+	}
+	s.MustRevoke(uid)
+	if s.MustRemaining(uid) != 0 || s.MustConsume(uid, newcodes[2]) {
+		t.Fatal()
+	}
+}
+
+func TestDirective(t *testing.T) {
+	data, err := json.Marshal(map[string]interface{}{
+		"Count":  5,
+		"Length": 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := usersystem.New()
+	MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	d, err := DirectiveFactory(json.NewDecoder(bytes.NewBuffer(data)).Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := MustGetModule(s)
+	if service == nil || service.Count != 5 || service.Length != 16 {
+		t.Fatal(service)
+	}
+	err = herbsystem.Catch(func() {
+		service.MustGenerate("test")
+	})
+	if err != ErrStoreNotSet {
+		t.Fatal(err)
+	}
+	service.Store = &testStore{data: map[string][]string{}}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	if len(service.MustGenerate("test")) != 5 {
+		t.Fatal()
+	}
+}
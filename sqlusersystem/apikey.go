@@ -0,0 +1,217 @@
+package sqlusersystem
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/herb-go/datasource/sql/db"
+	"github.com/herb-go/datasource/sql/querybuilder/modelmapper"
+	"github.com/herb-go/usersystem-drivers/apikey"
+)
+
+//APIKeyTableName return actual api key database table name.
+func (u *User) APIKeyTableName() string {
+	return u.DB.BuildTableName(u.Tables.APIKeyMapperName)
+}
+
+//APIKey return api key mapper
+func (u *User) APIKey() *APIKeyMapper {
+	return &APIKeyMapper{
+		ModelMapper: modelmapper.New(db.NewTable(u.DB, u.Tables.APIKeyMapperName)),
+		User:        u,
+	}
+}
+
+//APIKeySchema return api key table schema by user config.
+func (u *User) APIKeySchema() *TableSchema {
+	return &TableSchema{
+		Columns: u.tenantColumns(
+			&Column{Name: "id", Type: ColumnTypeString},
+			&Column{Name: "uid", Type: ColumnTypeString},
+			&Column{Name: "name", Type: ColumnTypeString},
+			&Column{Name: "scopes", Type: ColumnTypeText},
+			&Column{Name: "hash", Type: ColumnTypeString},
+			&Column{Name: "created_time", Type: ColumnTypeBigInt},
+			&Column{Name: "expired_time", Type: ColumnTypeBigInt},
+			&Column{Name: "last_used_time", Type: ColumnTypeBigInt},
+		),
+		PrimaryKey: []string{"id"},
+		Indexes:    [][]string{u.tenantKeys("uid")},
+	}
+}
+
+//APIKeyMapper api key mapper
+type APIKeyMapper struct {
+	*modelmapper.ModelMapper
+	User *User
+	//Context context used to load tenant.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+func (a *APIKeyMapper) WithContext(ctx context.Context) *APIKeyMapper {
+	m := *a
+	m.Context = ctx
+	return &m
+}
+
+//Start start service.
+//Api key table schema will be verified.
+func (a *APIKeyMapper) Start() error {
+	return a.User.VerifyTable(a.User.APIKeyTableName(), a.User.APIKeySchema())
+}
+
+//Stop stop service
+func (a *APIKeyMapper) Stop() error {
+	return nil
+}
+
+//MustInsertAPIKey insert new api key.
+func (a *APIKeyMapper) MustInsertAPIKey(key *apikey.Key) {
+	query := a.User.QueryBuilder
+	Insert := query.NewInsertQuery(a.TableName())
+	Insert.Insert.
+		Add("id", key.ID).
+		Add("uid", key.UID).
+		Add("name", key.Name).
+		Add("scopes", strings.Join(key.Scopes, " ")).
+		Add("hash", key.Hash).
+		Add("created_time", key.CreatedTime).
+		Add("expired_time", key.ExpiredTime).
+		Add("last_used_time", key.LastUsedTime)
+	if a.User.MultiTenant {
+		Insert.Insert.Add(TenantColumn, a.User.TenantFromContext(a.Context))
+	}
+	_, err := Insert.Query().Exec(a.DB())
+	if err != nil {
+		panic(err)
+	}
+}
+
+//MustFindAPIKey find api key by key id.
+//Return nil if not found.
+func (a *APIKeyMapper) MustFindAPIKey(id string) *apikey.Key {
+	query := a.User.QueryBuilder
+	Select := query.NewSelectQuery()
+	Select.Select.Add("apikey.id", "apikey.uid", "apikey.name", "apikey.scopes", "apikey.hash", "apikey.created_time", "apikey.expired_time", "apikey.last_used_time")
+	Select.From.AddAlias("apikey", a.TableName())
+	Select.Where.Condition = a.User.scope(a.Context, "apikey."+TenantColumn, query.Equal("apikey.id", id))
+	row := Select.QueryRow(a.DB())
+	var result = &apikey.Key{}
+	var scopes string
+	err := Select.Result().
+		Bind("apikey.id", &result.ID).
+		Bind("apikey.uid", &result.UID).
+		Bind("apikey.name", &result.Name).
+		Bind("apikey.scopes", &scopes).
+		Bind("apikey.hash", &result.Hash).
+		Bind("apikey.created_time", &result.CreatedTime).
+		Bind("apikey.expired_time", &result.ExpiredTime).
+		Bind("apikey.last_used_time", &result.LastUsedTime).
+		ScanFrom(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		panic(err)
+	}
+	result.Scopes = strings.Fields(scopes)
+	return result
+}
+
+//MustListAPIKeys list api keys of given uid.
+func (a *APIKeyMapper) MustListAPIKeys(uid string) []*apikey.Key {
+	query := a.User.QueryBuilder
+	Select := query.NewSelectQuery()
+	Select.Select.Add("apikey.id", "apikey.uid", "apikey.name", "apikey.scopes", "apikey.hash", "apikey.created_time", "apikey.expired_time", "apikey.last_used_time")
+	Select.From.AddAlias("apikey", a.TableName())
+	Select.Where.Condition = a.User.scope(a.Context, "apikey."+TenantColumn, query.Equal("apikey.uid", uid))
+	Select.OrderBy.Add("apikey.created_time", true)
+	rows, err := Select.QueryRows(a.DB())
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	var result = []*apikey.Key{}
+	for rows.Next() {
+		v := &apikey.Key{}
+		var scopes string
+		err = Select.Result().
+			Bind("apikey.id", &v.ID).
+			Bind("apikey.uid", &v.UID).
+			Bind("apikey.name", &v.Name).
+			Bind("apikey.scopes", &scopes).
+			Bind("apikey.hash", &v.Hash).
+			Bind("apikey.created_time", &v.CreatedTime).
+			Bind("apikey.expired_time", &v.ExpiredTime).
+			Bind("apikey.last_used_time", &v.LastUsedTime).
+			ScanFrom(rows)
+		if err != nil {
+			panic(err)
+		}
+		v.Scopes = strings.Fields(scopes)
+		result = append(result, v)
+	}
+	return result
+}
+
+//MustRevokeAPIKey revoke api key by uid and key id.
+//Return whether key existed.
+func (a *APIKeyMapper) MustRevokeAPIKey(uid string, id string) bool {
+	query := a.User.QueryBuilder
+	Delete := query.NewDeleteQuery(a.TableName())
+	Delete.Where.Condition = a.User.scope(a.Context, TenantColumn,
+		query.Equal("uid", uid),
+		query.Equal("id", id),
+	)
+	r, err := Delete.Query().Exec(a.DB())
+	if err != nil {
+		panic(err)
+	}
+	affected, err := r.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return affected != 0
+}
+
+//RevokeAll revoke all api keys of given uid in given transaction.
+//Return any error if raised.
+func (a *APIKeyMapper) RevokeAll(tx *sql.Tx, uid string) error {
+	query := a.User.QueryBuilder
+	Delete := query.NewDeleteQuery(a.TableName())
+	Delete.Where.Condition = a.User.scope(a.Context, TenantColumn, query.Equal("uid", uid))
+	_, err := Delete.Query().Exec(tx)
+	return err
+}
+
+//MustRevokeAllAPIKeys revoke all api keys of given uid.
+func (a *APIKeyMapper) MustRevokeAllAPIKeys(uid string) {
+	tx, err := a.DB().Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+	err = a.RevokeAll(tx, uid)
+	if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+}
+
+//MustTouchAPIKey update last used time of given key id.
+func (a *APIKeyMapper) MustTouchAPIKey(id string, lastused int64) {
+	query := a.User.QueryBuilder
+	Update := query.NewUpdateQuery(a.TableName())
+	Update.Update.
+		Add("last_used_time", lastused)
+	Update.Where.Condition = a.User.scope(a.Context, TenantColumn, query.Equal("id", id))
+	_, err := Update.Query().Exec(a.DB())
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,206 @@
+package sqlusersystem
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/herb-go/datasource/sql/querybuilder/modelmapper"
+	"github.com/herb-go/user/status"
+)
+
+//AuditEventBind audit event type for account binding.
+const AuditEventBind = "bind"
+
+//AuditEventUnbind audit event type for account unbinding.
+const AuditEventUnbind = "unbind"
+
+//AuditEventStatus audit event type for status changing.
+const AuditEventStatus = "status"
+
+//AuditEventPassword audit event type for password updating.
+const AuditEventPassword = "password"
+
+//AuditEventTerm audit event type for new term starting.
+const AuditEventTerm = "term"
+
+type auditContextKey string
+
+//ContextKeyAuditInfo context key for audit info.
+var ContextKeyAuditInfo = auditContextKey("auditinfo")
+
+//AuditInfo caller supplied audit info.
+type AuditInfo struct {
+	//Actor who made the change.
+	Actor string
+	//Reason why the change was made.
+	Reason string
+}
+
+//ContextWithAuditInfo return new context with given actor and reason.
+func ContextWithAuditInfo(ctx context.Context, actor string, reason string) context.Context {
+	return context.WithValue(ctx, ContextKeyAuditInfo, &AuditInfo{Actor: actor, Reason: reason})
+}
+
+//GetAuditInfo get audit info from context.
+//Empty audit info will be returned if not found.
+func GetAuditInfo(ctx context.Context) *AuditInfo {
+	info, ok := lookupAuditInfo(ctx)
+	if ok {
+		return info
+	}
+	return &AuditInfo{}
+}
+
+func lookupAuditInfo(ctx context.Context) (*AuditInfo, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	info, ok := ctx.Value(ContextKeyAuditInfo).(*AuditInfo)
+	return info, ok && info != nil
+}
+
+//AuditInfoFromContext return audit info in given context.
+//Audit info in context loaded by user context loader will be used if not found in given context.
+//User audit actor and reason will be used if audit info not found in both contexts.
+func (u *User) AuditInfoFromContext(ctx context.Context) *AuditInfo {
+	info, ok := lookupAuditInfo(ctx)
+	if ok {
+		return info
+	}
+	info, ok = lookupAuditInfo(u.loadContext())
+	if ok {
+		return info
+	}
+	return &AuditInfo{Actor: u.AuditActor, Reason: u.AuditReason}
+}
+
+//AuditModel audit log data model
+type AuditModel struct {
+	//EventType audit event type.
+	EventType string
+	//UID user id.
+	UID string
+	//Keyword affected account keyword.
+	Keyword string
+	//Account affected account name.
+	Account string
+	//OldStatus user status before change.
+	OldStatus status.Status
+	//NewStatus user status after change.
+	NewStatus status.Status
+	//Actor who made the change.
+	Actor string
+	//Reason why the change was made.
+	Reason string
+	//CreatedTime created timestamp in second.
+	CreatedTime int64
+}
+
+//NewAuditModel create new audit model with given event type,uid and audit info in context.
+func NewAuditModel(ctx context.Context, eventtype string, uid string) *AuditModel {
+	info := GetAuditInfo(ctx)
+	return &AuditModel{
+		EventType:   eventtype,
+		UID:         uid,
+		OldStatus:   status.StatusUnkown,
+		NewStatus:   status.StatusUnkown,
+		Actor:       info.Actor,
+		Reason:      info.Reason,
+		CreatedTime: time.Now().Unix(),
+	}
+}
+
+//AuditMapper audit log mapper
+type AuditMapper struct {
+	*modelmapper.ModelMapper
+	User *User
+	//Context context used to load tenant.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+func (a *AuditMapper) WithContext(ctx context.Context) *AuditMapper {
+	m := *a
+	m.Context = ctx
+	return &m
+}
+
+//Insert insert audit model in given transaction.
+//Return any error if raised.
+func (a *AuditMapper) Insert(tx *sql.Tx, model *AuditModel) error {
+	query := a.User.QueryBuilder
+	Insert := query.NewInsertQuery(a.TableName())
+	Insert.Insert.
+		Add("event_type", model.EventType).
+		Add("uid", model.UID).
+		Add("keyword", model.Keyword).
+		Add("account", model.Account).
+		Add("old_status", model.OldStatus).
+		Add("new_status", model.NewStatus).
+		Add("actor", model.Actor).
+		Add("reason", model.Reason).
+		Add("created_time", model.CreatedTime)
+	if a.User.MultiTenant {
+		Insert.Insert.Add(TenantColumn, a.User.TenantFromContext(a.Context))
+	}
+	_, err := Insert.Query().Exec(tx)
+	return err
+}
+
+//FindByUID find audit models by given uid in time range [from,to).
+//Zero from or to means no limit.
+//Results are ordered by created time and id.
+//Return audit models and any error if raised.
+func (a *AuditMapper) FindByUID(uid string, from int64, to int64, limit int) ([]*AuditModel, error) {
+	query := a.User.QueryBuilder
+	Select := query.NewSelectQuery()
+	Select.Select.Add("audit.event_type", "audit.uid", "audit.keyword", "audit.account", "audit.old_status", "audit.new_status", "audit.actor", "audit.reason", "audit.created_time")
+	Select.From.AddAlias("audit", a.TableName())
+	Select.Where.Condition = a.User.scope(a.Context, "audit."+TenantColumn, query.Equal("audit.uid", uid))
+	if from != 0 {
+		Select.Where.Condition = Select.Where.Condition.And(query.New("audit.created_time >= ?", from))
+	}
+	if to != 0 {
+		Select.Where.Condition = Select.Where.Condition.And(query.New("audit.created_time < ?", to))
+	}
+	if limit != 0 {
+		Select.Limit.Limit = &limit
+	}
+	Select.OrderBy.Add("audit.created_time", true)
+	Select.OrderBy.Add("audit.id", true)
+	rows, err := Select.QueryRows(a.DB())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result = []*AuditModel{}
+	for rows.Next() {
+		v := &AuditModel{}
+		err = Select.Result().
+			Bind("audit.event_type", &v.EventType).
+			Bind("audit.uid", &v.UID).
+			Bind("audit.keyword", &v.Keyword).
+			Bind("audit.account", &v.Account).
+			Bind("audit.old_status", &v.OldStatus).
+			Bind("audit.new_status", &v.NewStatus).
+			Bind("audit.actor", &v.Actor).
+			Bind("audit.reason", &v.Reason).
+			Bind("audit.created_time", &v.CreatedTime).
+			ScanFrom(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+//MustFindByUID find audit models by given uid in time range [from,to).
+func (a *AuditMapper) MustFindByUID(uid string, from int64, to int64, limit int) []*AuditModel {
+	result, err := a.FindByUID(uid, from, to, limit)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/herb-go/datasource/sql/querybuilder"
 	"github.com/herb-go/uniqueid"
 	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/apikey"
+	"github.com/herb-go/usersystem-drivers/recoverycode"
+	"github.com/herb-go/usersystem-drivers/totp"
 	"github.com/herb-go/usersystem/modules/useraccount"
 	"github.com/herb-go/usersystem/modules/userpassword"
 	"github.com/herb-go/usersystem/modules/userstatus"
@@ -12,12 +15,39 @@ import (
 )
 
 type Config struct {
-	Database      *db.Config
-	TableAccount  string
-	TablePassword string
-	TableToken    string
-	TableUser     string
-	Prefix        string
+	Database          *db.Config
+	TableAccount      string
+	TablePassword     string
+	TableToken        string
+	TableUser         string
+	TableAuditLog     string
+	TableTOTP         string
+	TableRecoveryCode string
+	TableAPIKey       string
+	Prefix            string
+	MultiTenant       bool
+	Tenant            string
+	//UIDGenerator uid generator config.
+	//uniqueid.DefaultGenerator will be used if nil.
+	UIDGenerator *GeneratorConfig
+	//TokenGenerator token generator config.
+	//Timestamp will be used if nil.
+	TokenGenerator *GeneratorConfig
+	//SaltGenerator salt generator config.
+	//RandomBytes will be used if nil.
+	SaltGenerator *GeneratorConfig
+	//Encryption keyring config used to encrypt sensitive columns.
+	//Columns will be stored in plaintext if nil.
+	Encryption *KeyringConfig
+	//AutoMigrate whether create missing tables and columns when service start.
+	//Service will fail to start with missing tables or columns if false.
+	AutoMigrate bool
+	//RevokeAPIKeysOnNewTerm whether revoke all api keys of user when new term started.
+	RevokeAPIKeysOnNewTerm bool
+	//AuditActor actor recorded in audit log when not found in context.
+	AuditActor string
+	//AuditReason reason recorded in audit log when not found in context.
+	AuditReason string
 }
 
 func (c *Config) ApplyToUser(u *User) error {
@@ -33,15 +63,57 @@ func (c *Config) ApplyToUser(u *User) error {
 	u.QueryBuilder = q
 	u.DB = database
 	u.UIDGenerater = uniqueid.DefaultGenerator.GenerateID
+	if c.UIDGenerator != nil {
+		u.UIDGenerater, err = c.UIDGenerator.CreateGenerator()
+		if err != nil {
+			return err
+		}
+	}
+	if c.TokenGenerator != nil {
+		u.TokenGenerater, err = c.TokenGenerator.CreateGenerator()
+		if err != nil {
+			return err
+		}
+	}
+	if c.SaltGenerator != nil {
+		u.SaltGenerater, err = c.SaltGenerator.CreateGenerator()
+		if err != nil {
+			return err
+		}
+	}
 	u.Tables.AccountMapperName = c.TableAccount
 	u.Tables.PasswordMapperName = c.TablePassword
 	u.Tables.UserMapperName = c.TableUser
 	u.Tables.TokenMapperName = c.TableToken
+	u.Tables.AuditMapperName = c.TableAuditLog
+	u.Tables.TOTPMapperName = c.TableTOTP
+	u.Tables.RecoveryCodeMapperName = c.TableRecoveryCode
+	u.Tables.APIKeyMapperName = c.TableAPIKey
 	u.AddTablePrefix(c.Prefix)
+	u.MultiTenant = c.MultiTenant
+	u.Tenant = c.Tenant
+	u.AutoMigrate = c.AutoMigrate
+	u.RevokeAPIKeysOnNewTerm = c.RevokeAPIKeysOnNewTerm
+	u.AuditActor = c.AuditActor
+	u.AuditReason = c.AuditReason
+	if c.Encryption != nil {
+		u.Keyring, err = c.Encryption.CreateKeyring()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+//Execute apply config to new user and install its mappers to given usersystem.
 func (c *Config) Execute(s *usersystem.UserSystem) error {
-	u := New()
+	return c.InstallTo(s, New())
+}
+
+//InstallTo apply config to given user and install its mappers to given usersystem.
+//User fields not in config like ContextLoader are kept,
+//so tenant and audit info can be supplied to installed mappers.
+func (c *Config) InstallTo(s *usersystem.UserSystem, u *User) error {
 	err := c.ApplyToUser(u)
 	if err != nil {
 		return err
@@ -70,6 +142,24 @@ func (c *Config) Execute(s *usersystem.UserSystem) error {
 			ut.Service = u.Token()
 		}
 	}
+	if c.TableTOTP != "" {
+		t := totp.MustGetModule(s)
+		if t != nil {
+			t.Store = u.TOTP()
+		}
+	}
+	if c.TableRecoveryCode != "" {
+		rc := recoverycode.MustGetModule(s)
+		if rc != nil {
+			rc.Store = u.RecoveryCode()
+		}
+	}
+	if c.TableAPIKey != "" {
+		ak := apikey.MustGetModule(s)
+		if ak != nil {
+			ak.Store = u.APIKey()
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,259 @@
+package sqlusersystem
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/herb-go/uniqueid"
+)
+
+//ErrGeneratorNotFound error raised when generator type not registered.
+var ErrGeneratorNotFound = errors.New("sqlusersystem:generator not found")
+
+//ErrSnowflakeNodeOutOfRange error raised when snowflake node id out of range.
+var ErrSnowflakeNodeOutOfRange = errors.New("sqlusersystem:snowflake node id out of range")
+
+//ErrSnowflakeClockMovedBackwards error raised when system clock moved backwards.
+var ErrSnowflakeClockMovedBackwards = errors.New("sqlusersystem:snowflake clock moved backwards")
+
+//DefaultBase32Length default random bytes length for base32 generator.
+var DefaultBase32Length = 16
+
+//SnowflakeEpoch epoch of snowflake generator in millisecond.
+//Default value is 2020-01-01 00:00:00 UTC.
+var SnowflakeEpoch int64 = 1577836800000
+
+//GeneratorConfig string generater config
+type GeneratorConfig struct {
+	//Type generator type registered by RegisterGenerator.
+	Type string
+	//Prefix prefix added to generated string.
+	Prefix string
+	//Node node id used by snowflake generator.
+	//Generators with same node id share one snowflake generator in process,
+	//processes sharing database should use different node ids.
+	Node int64
+	//Length random bytes length used by base32 generator.
+	Length int
+}
+
+//CreateGenerator create string generater by config.
+//Return generater and any error if raised.
+func (c *GeneratorConfig) CreateGenerator() (func() (string, error), error) {
+	generatorLocker.Lock()
+	factory := generatorFactories[c.Type]
+	generatorLocker.Unlock()
+	if factory == nil {
+		return nil, fmt.Errorf("%w (%s)", ErrGeneratorNotFound, c.Type)
+	}
+	g, err := factory(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Prefix == "" {
+		return g, nil
+	}
+	prefix := c.Prefix
+	return func() (string, error) {
+		id, err := g()
+		if err != nil {
+			return "", err
+		}
+		return prefix + id, nil
+	}, nil
+}
+
+//GeneratorFactory factory to create string generater by config.
+type GeneratorFactory func(c *GeneratorConfig) (func() (string, error), error)
+
+var generatorLocker sync.Mutex
+
+//generatorFactories registered generator factories.
+//Factories should be registered by RegisterGenerator.
+var generatorFactories = map[string]GeneratorFactory{
+	"uniqueid": func(c *GeneratorConfig) (func() (string, error), error) {
+		return uniqueid.DefaultGenerator.GenerateID, nil
+	},
+	"timestamp": func(c *GeneratorConfig) (func() (string, error), error) {
+		return Timestamp, nil
+	},
+	"randombytes": func(c *GeneratorConfig) (func() (string, error), error) {
+		return RandomBytes, nil
+	},
+	"ulid": func(c *GeneratorConfig) (func() (string, error), error) {
+		return ULID, nil
+	},
+	"uuidv4": func(c *GeneratorConfig) (func() (string, error), error) {
+		return UUIDv4, nil
+	},
+	"uuidv7": func(c *GeneratorConfig) (func() (string, error), error) {
+		return UUIDv7, nil
+	},
+	"snowflake": func(c *GeneratorConfig) (func() (string, error), error) {
+		s, err := snowflakeOfNode(c.Node)
+		if err != nil {
+			return nil, err
+		}
+		return s.GenerateID, nil
+	},
+	"base32": func(c *GeneratorConfig) (func() (string, error), error) {
+		length := c.Length
+		if length <= 0 {
+			length = DefaultBase32Length
+		}
+		return func() (string, error) {
+			return RandomBase32(length)
+		}, nil
+	},
+}
+
+//RegisterGenerator register generator factory with given type name.
+func RegisterGenerator(name string, factory GeneratorFactory) {
+	generatorLocker.Lock()
+	defer generatorLocker.Unlock()
+	generatorFactories[name] = factory
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+//ULID string generater return ulid in crockford base32 which sorted by created time.
+func ULID() (string, error) {
+	var data [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	data[0] = byte(ms >> 40)
+	data[1] = byte(ms >> 32)
+	data[2] = byte(ms >> 24)
+	data[3] = byte(ms >> 16)
+	data[4] = byte(ms >> 8)
+	data[5] = byte(ms)
+	_, err := rand.Read(data[6:])
+	if err != nil {
+		return "", err
+	}
+	hi := binary.BigEndian.Uint64(data[:8])
+	lo := binary.BigEndian.Uint64(data[8:])
+	var result [26]byte
+	for i := 25; i >= 0; i-- {
+		result[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi = hi >> 5
+	}
+	return string(result[:]), nil
+}
+
+func formatUUID(data []byte) string {
+	s := hex.EncodeToString(data)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+//UUIDv4 string generater return random uuid version 4.
+func UUIDv4() (string, error) {
+	var data [16]byte
+	_, err := rand.Read(data[:])
+	if err != nil {
+		return "", err
+	}
+	data[6] = data[6]&0x0f | 0x40
+	data[8] = data[8]&0x3f | 0x80
+	return formatUUID(data[:]), nil
+}
+
+//UUIDv7 string generater return uuid version 7 which sorted by created time.
+func UUIDv7() (string, error) {
+	var data [16]byte
+	_, err := rand.Read(data[6:])
+	if err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	data[0] = byte(ms >> 40)
+	data[1] = byte(ms >> 32)
+	data[2] = byte(ms >> 24)
+	data[3] = byte(ms >> 16)
+	data[4] = byte(ms >> 8)
+	data[5] = byte(ms)
+	data[6] = data[6]&0x0f | 0x70
+	data[8] = data[8]&0x3f | 0x80
+	return formatUUID(data[:]), nil
+}
+
+//RandomBase32 return random bytes in given length encoded in lower case base32 without padding.
+func RandomBase32(length int) (string, error) {
+	var data = make([]byte, length)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(data)), nil
+}
+
+//Snowflake snowflake id generator.
+//Generated id contains 41 bit timestamp in millisecond,10 bit node id and 12 bit sequence.
+type Snowflake struct {
+	locker   sync.Mutex
+	node     int64
+	last     int64
+	sequence int64
+}
+
+//GenerateID generate new snowflake id in decimal.
+func (s *Snowflake) GenerateID() (string, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	now := time.Now().UnixNano()/int64(time.Millisecond) - SnowflakeEpoch
+	if now < s.last {
+		return "", ErrSnowflakeClockMovedBackwards
+	}
+	if now == s.last {
+		s.sequence = (s.sequence + 1) & 0xfff
+		if s.sequence == 0 {
+			for now <= s.last {
+				time.Sleep(time.Millisecond / 10)
+				now = time.Now().UnixNano()/int64(time.Millisecond) - SnowflakeEpoch
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.last = now
+	return strconv.FormatInt(now<<22|s.node<<12|s.sequence, 10), nil
+}
+
+//NewSnowflake create new snowflake generator with given node id.
+//Node id must be in range [0,1023].
+//Snowflake generators with same node id may generate duplicate ids,
+//so every generator should have its own node id.
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > 1023 {
+		return nil, ErrSnowflakeNodeOutOfRange
+	}
+	return &Snowflake{node: node}, nil
+}
+
+var snowflakeLocker sync.Mutex
+var snowflakes = map[int64]*Snowflake{}
+
+//snowflakeOfNode return snowflake generator shared in process by given node id,
+//so generators created by configs with same node id never generate duplicate ids.
+func snowflakeOfNode(node int64) (*Snowflake, error) {
+	snowflakeLocker.Lock()
+	defer snowflakeLocker.Unlock()
+	s := snowflakes[node]
+	if s != nil {
+		return s, nil
+	}
+	s, err := NewSnowflake(node)
+	if err != nil {
+		return nil, err
+	}
+	snowflakes[node] = s
+	return s, nil
+}
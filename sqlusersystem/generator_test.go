@@ -0,0 +1,94 @@
+package sqlusersystem
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerator(t *testing.T) {
+	patterns := map[string]*regexp.Regexp{
+		"ulid":   regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`),
+		"uuidv4": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		"uuidv7": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		"base32": regexp.MustCompile(`^[a-z2-7]{26}$`),
+	}
+	for k, v := range patterns {
+		g, err := (&GeneratorConfig{Type: k}).CreateGenerator()
+		if err != nil {
+			t.Fatal(k, err)
+		}
+		id, err := g()
+		if err != nil || !v.MatchString(id) {
+			t.Fatal(k, id, err)
+		}
+		id2, err := g()
+		if err != nil || id == id2 {
+			t.Fatal(k, id2, err)
+		}
+	}
+	for _, k := range []string{"ulid", "uuidv7"} {
+		g, _ := (&GeneratorConfig{Type: k}).CreateGenerator()
+		id, _ := g()
+		time.Sleep(2 * time.Millisecond)
+		id2, _ := g()
+		if id >= id2 {
+			t.Fatal(k, id, id2)
+		}
+	}
+	g, err := (&GeneratorConfig{Type: "base32", Prefix: "usr_", Length: 5}).CreateGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := g()
+	if err != nil || !strings.HasPrefix(id, "usr_") || len(id) != 12 {
+		t.Fatal(id, err)
+	}
+	g, err = (&GeneratorConfig{Type: "snowflake", Node: 1}).CreateGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last string
+	for i := 0; i < 10000; i++ {
+		id, err = g()
+		if err != nil || id <= last {
+			t.Fatal(id, last, err)
+		}
+		last = id
+	}
+	g2, err := (&GeneratorConfig{Type: "snowflake", Node: 1}).CreateGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		for _, v := range []func() (string, error){g, g2} {
+			id, err = v()
+			if err != nil || ids[id] {
+				t.Fatal(id, err)
+			}
+			ids[id] = true
+		}
+	}
+	_, err = (&GeneratorConfig{Type: "snowflake", Node: 1024}).CreateGenerator()
+	if err != ErrSnowflakeNodeOutOfRange {
+		t.Fatal(err)
+	}
+	_, err = (&GeneratorConfig{Type: "notexist"}).CreateGenerator()
+	if !errors.Is(err, ErrGeneratorNotFound) {
+		t.Fatal(err)
+	}
+	RegisterGenerator("static", func(c *GeneratorConfig) (func() (string, error), error) {
+		return func() (string, error) { return "static", nil }, nil
+	})
+	g, err = (&GeneratorConfig{Type: "static", Prefix: "p"}).CreateGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err = g()
+	if err != nil || id != "pstatic" {
+		t.Fatal(id, err)
+	}
+}
@@ -0,0 +1,193 @@
+package sqlusersystem
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrKeyNotFound error raised when encryption key not found in keyring.
+var ErrKeyNotFound = errors.New("sqlusersystem:encryption key not found")
+
+//ErrInvalidCiphertext error raised when ciphertext format invalid.
+var ErrInvalidCiphertext = errors.New("sqlusersystem:invalid ciphertext")
+
+//ErrIndexKeyRequired error raised when blind index key is empty.
+var ErrIndexKeyRequired = errors.New("sqlusersystem:blind index key required")
+
+//ErrInvalidKeyID error raised when key id is empty or contains reserved characters.
+var ErrInvalidKeyID = errors.New("sqlusersystem:invalid key id")
+
+//ValidateKeyID validate given key id.
+//Key id should not be empty or contain ":",which separates key id in ciphertext,
+//or "%" and "_",which are wildcards when searching ciphertexts by key id.
+func ValidateKeyID(id string) error {
+	if id == "" || strings.ContainsAny(id, ":%_") {
+		return fmt.Errorf("%w (%s)", ErrInvalidKeyID, id)
+	}
+	return nil
+}
+
+//Keyring aes-gcm encryption keyring.
+//Data is encrypted by current key,and can be decrypted by any key in keyring,
+//so old keys should be kept until all data re-encrypted.
+type Keyring struct {
+	//Current current key id used to encrypt data.
+	Current string
+	//Keys all available keys by key id.
+	Keys map[string][]byte
+	//IndexKey hmac key used to generate blind index.
+	IndexKey []byte
+}
+
+func (k *Keyring) aead(id string) (cipher.AEAD, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//Encrypt encrypt data with current key.
+//Return ciphertext in "keyid:base64data" format and any error if raised.
+func (k *Keyring) Encrypt(data []byte) (string, error) {
+	err := ValidateKeyID(k.Current)
+	if err != nil {
+		return "", err
+	}
+	aead, err := k.aead(k.Current)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, data, []byte(k.Current))
+	return k.Current + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+//Decrypt decrypt ciphertext created by Encrypt.
+//Return data and any error if raised.
+func (k *Keyring) Decrypt(ciphertext string) ([]byte, error) {
+	id, encoded := KeyIDOf(ciphertext)
+	if encoded == "" {
+		return nil, ErrInvalidCiphertext
+	}
+	aead, err := k.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+}
+
+//EncryptString encrypt string with current key.
+func (k *Keyring) EncryptString(data string) (string, error) {
+	return k.Encrypt([]byte(data))
+}
+
+//DecryptString decrypt ciphertext to string.
+func (k *Keyring) DecryptString(ciphertext string) (string, error) {
+	data, err := k.Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//NeedReencrypt check if ciphertext is not encrypted by current key.
+func (k *Keyring) NeedReencrypt(ciphertext string) bool {
+	id, _ := KeyIDOf(ciphertext)
+	return id != k.Current
+}
+
+//BlindIndex return deterministic hmac-sha256 index of given values.
+//Values are joined with zero byte before hashing.
+func (k *Keyring) BlindIndex(values ...string) (string, error) {
+	if len(k.IndexKey) == 0 {
+		return "", ErrIndexKeyRequired
+	}
+	h := hmac.New(sha256.New, k.IndexKey)
+	h.Write([]byte(strings.Join(values, "\x00")))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+//KeyIDOf split ciphertext into key id and encrypted data.
+func KeyIDOf(ciphertext string) (string, string) {
+	i := strings.Index(ciphertext, ":")
+	if i < 0 {
+		return "", ""
+	}
+	return ciphertext[:i], ciphertext[i+1:]
+}
+
+//NewKeyring create new keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{
+		Keys: map[string][]byte{},
+	}
+}
+
+//KeyringConfig keyring config
+type KeyringConfig struct {
+	//Current current key id used to encrypt data.
+	Current string
+	//Keys base64 encoded aes keys by key id.
+	//Key length should be 16,24 or 32 bytes.
+	Keys map[string]string
+	//IndexKey base64 encoded hmac key used to generate blind index.
+	IndexKey string
+}
+
+//CreateKeyring create keyring by config.
+//Return keyring and any error if raised.
+func (c *KeyringConfig) CreateKeyring() (*Keyring, error) {
+	k := NewKeyring()
+	k.Current = c.Current
+	for id, v := range c.Keys {
+		err := ValidateKeyID(id)
+		if err != nil {
+			return nil, err
+		}
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		_, err = aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		k.Keys[id] = key
+	}
+	if _, ok := k.Keys[k.Current]; !ok {
+		return nil, ErrKeyNotFound
+	}
+	index, err := base64.StdEncoding.DecodeString(c.IndexKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(index) == 0 {
+		return nil, ErrIndexKeyRequired
+	}
+	k.IndexKey = index
+	return k, nil
+}
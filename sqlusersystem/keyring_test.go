@@ -0,0 +1,95 @@
+package sqlusersystem
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	c := &KeyringConfig{
+		Current: "key1",
+		Keys: map[string]string{
+			"key1": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")),
+		},
+		IndexKey: base64.StdEncoding.EncodeToString([]byte("indexkey")),
+	}
+	k, err := c.CreateKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := k.EncryptString("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2, err := k.EncryptString("test@example.com")
+	if err != nil || e == e2 {
+		t.Fatal(e2, err)
+	}
+	d, err := k.DecryptString(e)
+	if err != nil || d != "test@example.com" {
+		t.Fatal(d, err)
+	}
+	i, err := k.BlindIndex("email", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i2, err := k.BlindIndex("email", "test@example.com")
+	if err != nil || i != i2 {
+		t.Fatal(i2, err)
+	}
+	i2, err = k.BlindIndex("phone", "test@example.com")
+	if err != nil || i == i2 {
+		t.Fatal(i2, err)
+	}
+	if k.NeedReencrypt(e) {
+		t.Fatal(e)
+	}
+	c.Current = "key2"
+	c.Keys["key2"] = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	k, err = c.CreateKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.NeedReencrypt(e) {
+		t.Fatal(e)
+	}
+	d, err = k.DecryptString(e)
+	if err != nil || d != "test@example.com" {
+		t.Fatal(d, err)
+	}
+	delete(k.Keys, "key1")
+	_, err = k.DecryptString(e)
+	if err != ErrKeyNotFound {
+		t.Fatal(err)
+	}
+	_, err = k.DecryptString("invalid")
+	if err != ErrInvalidCiphertext {
+		t.Fatal(err)
+	}
+	c.Current = "notexist"
+	_, err = c.CreateKeyring()
+	if err != ErrKeyNotFound {
+		t.Fatal(err)
+	}
+	c.Current = "key1"
+	c.IndexKey = ""
+	_, err = c.CreateKeyring()
+	if err != ErrIndexKeyRequired {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"", "key:3", "key%", "key_3"} {
+		c.Keys[id] = c.Keys["key1"]
+		_, err = c.CreateKeyring()
+		if !errors.Is(err, ErrInvalidKeyID) {
+			t.Fatal(id, err)
+		}
+		delete(c.Keys, id)
+		k.Current = id
+		k.Keys[id] = k.Keys["key2"]
+		_, err = k.EncryptString("test@example.com")
+		if !errors.Is(err, ErrInvalidKeyID) {
+			t.Fatal(id, err)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE account 
+    ADD COLUMN account_encrypted VARCHAR(1024) not null default '',
+    ADD index (account_encrypted(32));
@@ -0,0 +1,12 @@
+CREATE TABLE api_key(
+    id VARCHAR(255) not null,
+    uid VARCHAR(255) not null,
+    name VARCHAR(255) not null,
+    scopes VARCHAR(1024) not null,
+    hash VARCHAR(255) not null,
+    created_time BIGINT not null,
+    expired_time BIGINT not null,
+    last_used_time BIGINT not null,
+    PRIMARY KEY(id),
+    index (uid)
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB;
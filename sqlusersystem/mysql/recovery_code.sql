@@ -0,0 +1,6 @@
+CREATE TABLE recovery_code(
+    uid VARCHAR(255) not null,
+    code_hash VARCHAR(255) not null,
+    created_time BIGINT not null,
+    PRIMARY KEY(uid,code_hash)
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB;
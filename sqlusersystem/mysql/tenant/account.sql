@@ -0,0 +1,13 @@
+CREATE TABLE account(
+    tenant VARCHAR(255) not null,
+    uid VARCHAR(255) not null,
+    keyword VARCHAR(255) not null,
+    account VARCHAR(255)
+    CHARACTER SET utf8 
+    COLLATE utf8_bin
+    not null,
+    created_time BIGINT not null,
+    PRIMARY KEY(tenant,keyword,account),
+    index (tenant,uid),
+    index (tenant,created_time,uid)
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB;
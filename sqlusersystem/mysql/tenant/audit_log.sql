@@ -0,0 +1,18 @@
+CREATE TABLE audit_log(
+    id BIGINT not null AUTO_INCREMENT,
+    tenant VARCHAR(255) not null,
+    event_type VARCHAR(64) not null,
+    uid VARCHAR(255) not null,
+    keyword VARCHAR(255) not null,
+    account VARCHAR(255)
+    CHARACTER SET utf8 
+    COLLATE utf8_bin
+    not null,
+    old_status int not null,
+    new_status int not null,
+    actor VARCHAR(255) not null,
+    reason VARCHAR(1024) not null,
+    created_time BIGINT not null,
+    PRIMARY KEY(id),
+    index (tenant,uid,created_time)
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB;
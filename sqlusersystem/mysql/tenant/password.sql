@@ -0,0 +1,12 @@
+CREATE TABLE password(
+    tenant VARCHAR(255) not null,
+    uid VARCHAR(255) not null,
+    hash_method VARCHAR(255),
+    salt VARCHAR(255) not null,
+    password VARCHAR(255)
+    CHARACTER SET utf8 
+    COLLATE utf8_bin    
+    not null,
+    updated_time BIGINT not null,
+    PRIMARY KEY(tenant,uid)    
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB; 
@@ -0,0 +1,7 @@
+CREATE TABLE token(
+    tenant VARCHAR(255) not null,
+    uid VARCHAR(255) not null,
+    updated_time BIGINT not null,
+    token VARCHAR(255),
+    PRIMARY KEY(tenant,uid)
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB; 
@@ -0,0 +1,9 @@
+CREATE TABLE user(
+    tenant VARCHAR(255) not null,
+    uid VARCHAR(255) not null,
+    created_time BIGINT not null,
+    updated_time BIGINT not null,
+    status int not null,
+    PRIMARY KEY(tenant,uid),
+    index (tenant,created_time,uid)
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci  ENGINE=InnoDB;
@@ -0,0 +1,8 @@
+CREATE TABLE totp(
+    uid VARCHAR(255) not null,
+    secret VARCHAR(1024) not null,
+    confirmed int not null,
+    last_counter BIGINT not null,
+    created_time BIGINT not null,
+    PRIMARY KEY(uid)
+) DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB;
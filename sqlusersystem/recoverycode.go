@@ -0,0 +1,139 @@
+package sqlusersystem
+
+import (
+	"context"
+	"time"
+
+	"github.com/herb-go/datasource/sql/db"
+	"github.com/herb-go/datasource/sql/querybuilder/modelmapper"
+)
+
+//RecoveryCodeTableName return actual recovery code database table name.
+func (u *User) RecoveryCodeTableName() string {
+	return u.DB.BuildTableName(u.Tables.RecoveryCodeMapperName)
+}
+
+//RecoveryCode return recovery code mapper
+func (u *User) RecoveryCode() *RecoveryCodeMapper {
+	return &RecoveryCodeMapper{
+		ModelMapper: modelmapper.New(db.NewTable(u.DB, u.Tables.RecoveryCodeMapperName)),
+		User:        u,
+	}
+}
+
+//RecoveryCodeSchema return recovery code table schema by user config.
+func (u *User) RecoveryCodeSchema() *TableSchema {
+	return &TableSchema{
+		Columns: u.tenantColumns(
+			&Column{Name: "uid", Type: ColumnTypeString},
+			&Column{Name: "code_hash", Type: ColumnTypeString},
+			&Column{Name: "created_time", Type: ColumnTypeBigInt},
+		),
+		PrimaryKey: u.tenantKeys("uid", "code_hash"),
+	}
+}
+
+//RecoveryCodeMapper recovery code mapper
+type RecoveryCodeMapper struct {
+	*modelmapper.ModelMapper
+	User *User
+	//Context context used to load tenant.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+func (r *RecoveryCodeMapper) WithContext(ctx context.Context) *RecoveryCodeMapper {
+	m := *r
+	m.Context = ctx
+	return &m
+}
+
+//Start start service.
+//Recovery code table schema will be verified.
+func (r *RecoveryCodeMapper) Start() error {
+	return r.User.VerifyTable(r.User.RecoveryCodeTableName(), r.User.RecoveryCodeSchema())
+}
+
+//Stop stop service
+func (r *RecoveryCodeMapper) Stop() error {
+	return nil
+}
+
+//MustLoadRecoveryCodes load recovery code hashes of given uid.
+func (r *RecoveryCodeMapper) MustLoadRecoveryCodes(uid string) []string {
+	query := r.User.QueryBuilder
+	Select := query.NewSelectQuery()
+	Select.Select.Add("recoverycode.code_hash")
+	Select.From.AddAlias("recoverycode", r.TableName())
+	Select.Where.Condition = r.User.scope(r.Context, "recoverycode."+TenantColumn, query.Equal("recoverycode.uid", uid))
+	rows, err := Select.QueryRows(r.DB())
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	var result = []string{}
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, hash)
+	}
+	return result
+}
+
+//MustReplaceRecoveryCodes replace all recovery code hashes of given uid.
+func (r *RecoveryCodeMapper) MustReplaceRecoveryCodes(uid string, hashes []string) {
+	query := r.User.QueryBuilder
+	tx, err := r.DB().Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+	Delete := query.NewDeleteQuery(r.TableName())
+	Delete.Where.Condition = r.User.scope(r.Context, TenantColumn, query.Equal("uid", uid))
+	_, err = Delete.Query().Exec(tx)
+	if err != nil {
+		panic(err)
+	}
+	var CreatedTime = time.Now().Unix()
+	for _, v := range hashes {
+		Insert := query.NewInsertQuery(r.TableName())
+		Insert.Insert.
+			Add("uid", uid).
+			Add("code_hash", v).
+			Add("created_time", CreatedTime)
+		if r.User.MultiTenant {
+			Insert.Insert.Add(TenantColumn, r.User.TenantFromContext(r.Context))
+		}
+		_, err = Insert.Query().Exec(tx)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+}
+
+//MustUseRecoveryCode remove given recovery code hash of given uid.
+//Return whether hash existed.
+func (r *RecoveryCodeMapper) MustUseRecoveryCode(uid string, hash string) bool {
+	query := r.User.QueryBuilder
+	Delete := query.NewDeleteQuery(r.TableName())
+	Delete.Where.Condition = r.User.scope(r.Context, TenantColumn,
+		query.Equal("uid", uid),
+		query.Equal("code_hash", hash),
+	)
+	result, err := Delete.Query().Exec(r.DB())
+	if err != nil {
+		panic(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return affected != 0
+}
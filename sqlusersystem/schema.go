@@ -0,0 +1,301 @@
+package sqlusersystem
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrAutoMigrateNotSupported error raised when auto migrate not supported by database driver.
+var ErrAutoMigrateNotSupported = errors.New("sqlusersystem:auto migrate not supported by driver")
+
+//ErrTenantMigrationNotSupported error raised when auto migrating existing table to multi tenant.
+//Primary key and indexes of existing table should be changed with tenant column manually.
+var ErrTenantMigrationNotSupported = errors.New("sqlusersystem:auto migrate existing table to multi tenant not supported")
+
+//SchemaError error raised when table or column not found in database.
+type SchemaError struct {
+	//Table actual table name.
+	Table string
+	//Column missing column name.
+	//Empty if table missing.
+	Column string
+	//Err error returned by database.
+	Err error
+}
+
+//Error return error message.
+func (e *SchemaError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("sqlusersystem:table %s not found (%s)", e.Table, e.Err)
+	}
+	return fmt.Sprintf("sqlusersystem:column %s of table %s not found (%s)", e.Column, e.Table, e.Err)
+}
+
+//Unwrap return error returned by database.
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+//Column types used in table schema.
+const (
+	ColumnTypeString = "string"
+	ColumnTypeBinary = "binary"
+	ColumnTypeText   = "text"
+	ColumnTypeInt    = "int"
+	ColumnTypeBigInt = "bigint"
+	ColumnTypeAutoID = "autoid"
+)
+
+//Column table column schema
+type Column struct {
+	//Name column name.
+	Name string
+	//Type column type.
+	Type string
+}
+
+//TableSchema table schema
+type TableSchema struct {
+	//Columns required columns.
+	Columns []*Column
+	//PrimaryKey primary key columns.
+	PrimaryKey []string
+	//Indexes secondary index columns.
+	Indexes [][]string
+}
+
+//Dialect database dialect used to create or upgrade tables.
+type Dialect struct {
+	//Types column type definitions.
+	Types map[string]string
+	//AutoIDPrimaryKey whether autoid column definition declares primary key itself.
+	AutoIDPrimaryKey bool
+	//TableOptions options appended to create table command.
+	TableOptions string
+}
+
+//Dialects registered dialects by database driver name.
+//You can insert custom dialect into this map.
+var Dialects = map[string]*Dialect{
+	"mysql": &Dialect{
+		Types: map[string]string{
+			ColumnTypeString: "VARCHAR(255) NOT NULL DEFAULT ''",
+			ColumnTypeBinary: "VARCHAR(255) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL DEFAULT ''",
+			ColumnTypeText:   "VARCHAR(1024) NOT NULL DEFAULT ''",
+			ColumnTypeInt:    "INT NOT NULL DEFAULT 0",
+			ColumnTypeBigInt: "BIGINT NOT NULL DEFAULT 0",
+			ColumnTypeAutoID: "BIGINT NOT NULL AUTO_INCREMENT",
+		},
+		TableOptions: "DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ENGINE=InnoDB",
+	},
+	"sqlite3": &Dialect{
+		Types: map[string]string{
+			ColumnTypeString: "TEXT NOT NULL DEFAULT ''",
+			ColumnTypeBinary: "TEXT NOT NULL DEFAULT ''",
+			ColumnTypeText:   "TEXT NOT NULL DEFAULT ''",
+			ColumnTypeInt:    "INTEGER NOT NULL DEFAULT 0",
+			ColumnTypeBigInt: "INTEGER NOT NULL DEFAULT 0",
+			ColumnTypeAutoID: "INTEGER PRIMARY KEY AUTOINCREMENT",
+		},
+		AutoIDPrimaryKey: true,
+	},
+}
+
+func (d *Dialect) createTable(table string, schema *TableSchema) []string {
+	var defs = make([]string, 0, len(schema.Columns)+1)
+	var autoid bool
+	for _, v := range schema.Columns {
+		defs = append(defs, v.Name+" "+d.Types[v.Type])
+		if v.Type == ColumnTypeAutoID {
+			autoid = true
+		}
+	}
+	if len(schema.PrimaryKey) > 0 && !(autoid && d.AutoIDPrimaryKey) {
+		defs = append(defs, "PRIMARY KEY("+strings.Join(schema.PrimaryKey, ",")+")")
+	}
+	var cmds = []string{
+		strings.TrimSpace("CREATE TABLE " + table + "(" + strings.Join(defs, ",") + ") " + d.TableOptions),
+	}
+	for _, v := range schema.Indexes {
+		cmds = append(cmds, "CREATE INDEX idx_"+table+"_"+strings.Join(v, "_")+" ON "+table+"("+strings.Join(v, ",")+")")
+	}
+	return cmds
+}
+
+func (d *Dialect) addColumn(table string, column *Column) string {
+	return "ALTER TABLE " + table + " ADD COLUMN " + column.Name + " " + d.Types[column.Type]
+}
+
+func (u *User) tenantColumns(columns ...*Column) []*Column {
+	if !u.MultiTenant {
+		return columns
+	}
+	return append([]*Column{&Column{Name: TenantColumn, Type: ColumnTypeString}}, columns...)
+}
+
+func (u *User) tenantKeys(keys ...string) []string {
+	if !u.MultiTenant {
+		return keys
+	}
+	return append([]string{TenantColumn}, keys...)
+}
+
+//AccountSchema return account table schema by user config.
+func (u *User) AccountSchema() *TableSchema {
+	columns := u.tenantColumns(
+		&Column{Name: "uid", Type: ColumnTypeString},
+		&Column{Name: "keyword", Type: ColumnTypeString},
+		&Column{Name: "account", Type: ColumnTypeBinary},
+		&Column{Name: "created_time", Type: ColumnTypeBigInt},
+	)
+	if u.Keyring != nil {
+		columns = append(columns, &Column{Name: "account_encrypted", Type: ColumnTypeText})
+	}
+	return &TableSchema{
+		Columns:    columns,
+		PrimaryKey: u.tenantKeys("keyword", "account"),
+		Indexes:    [][]string{u.tenantKeys("uid")},
+	}
+}
+
+//PasswordSchema return password table schema by user config.
+func (u *User) PasswordSchema() *TableSchema {
+	return &TableSchema{
+		Columns: u.tenantColumns(
+			&Column{Name: "uid", Type: ColumnTypeString},
+			&Column{Name: "hash_method", Type: ColumnTypeString},
+			&Column{Name: "salt", Type: ColumnTypeString},
+			&Column{Name: "password", Type: ColumnTypeBinary},
+			&Column{Name: "updated_time", Type: ColumnTypeBigInt},
+		),
+		PrimaryKey: u.tenantKeys("uid"),
+	}
+}
+
+//TokenSchema return token table schema by user config.
+func (u *User) TokenSchema() *TableSchema {
+	return &TableSchema{
+		Columns: u.tenantColumns(
+			&Column{Name: "uid", Type: ColumnTypeString},
+			&Column{Name: "updated_time", Type: ColumnTypeBigInt},
+			&Column{Name: "token", Type: ColumnTypeString},
+		),
+		PrimaryKey: u.tenantKeys("uid"),
+	}
+}
+
+//UserSchema return user table schema by user config.
+func (u *User) UserSchema() *TableSchema {
+	return &TableSchema{
+		Columns: u.tenantColumns(
+			&Column{Name: "uid", Type: ColumnTypeString},
+			&Column{Name: "created_time", Type: ColumnTypeBigInt},
+			&Column{Name: "updated_time", Type: ColumnTypeBigInt},
+			&Column{Name: "status", Type: ColumnTypeInt},
+		),
+		PrimaryKey: u.tenantKeys("uid"),
+		Indexes:    [][]string{u.tenantKeys("created_time", "uid")},
+	}
+}
+
+//AuditSchema return audit log table schema by user config.
+func (u *User) AuditSchema() *TableSchema {
+	columns := []*Column{&Column{Name: "id", Type: ColumnTypeAutoID}}
+	columns = append(columns, u.tenantColumns(
+		&Column{Name: "event_type", Type: ColumnTypeString},
+		&Column{Name: "uid", Type: ColumnTypeString},
+		&Column{Name: "keyword", Type: ColumnTypeString},
+		&Column{Name: "account", Type: ColumnTypeBinary},
+		&Column{Name: "old_status", Type: ColumnTypeInt},
+		&Column{Name: "new_status", Type: ColumnTypeInt},
+		&Column{Name: "actor", Type: ColumnTypeString},
+		&Column{Name: "reason", Type: ColumnTypeText},
+		&Column{Name: "created_time", Type: ColumnTypeBigInt},
+	)...)
+	return &TableSchema{
+		Columns:    columns,
+		PrimaryKey: []string{"id"},
+		Indexes:    [][]string{u.tenantKeys("uid", "created_time")},
+	}
+}
+
+func (u *User) checkTable(table string) error {
+	rows, err := u.DB.Query("SELECT 1 FROM " + table + " WHERE 1=0")
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+func (u *User) missingColumns(table string, schema *TableSchema) ([]*Column, []error, error) {
+	var columns []*Column
+	var errs []error
+	for _, v := range schema.Columns {
+		rows, err := u.DB.Query("SELECT " + v.Name + " FROM " + table + " WHERE 1=0")
+		if err != nil {
+			columns = append(columns, v)
+			errs = append(errs, err)
+			continue
+		}
+		err = rows.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return columns, errs, nil
+}
+
+//VerifyTable verify if given table and all required columns in schema exist.
+//Missing table or columns will be created if AutoMigrate is true.
+//Primary key and indexes of existing table will not be changed,
+//so *SchemaError wrapping ErrTenantMigrationNotSupported will be returned if tenant column missing in existing table.
+//Return *SchemaError or any error if raised.
+func (u *User) VerifyTable(table string, schema *TableSchema) error {
+	var dialect *Dialect
+	if u.AutoMigrate {
+		dialect = Dialects[u.QueryBuilder.Driver]
+		if dialect == nil {
+			return fmt.Errorf("%w (%s)", ErrAutoMigrateNotSupported, u.QueryBuilder.Driver)
+		}
+	}
+	err := u.checkTable(table)
+	if err != nil {
+		if dialect == nil {
+			return &SchemaError{Table: table, Err: err}
+		}
+		for _, cmd := range dialect.createTable(table, schema) {
+			_, err = u.DB.Exec(cmd)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	columns, errs, err := u.missingColumns(table, schema)
+	if err != nil {
+		return err
+	}
+	for k, v := range columns {
+		if dialect == nil {
+			return &SchemaError{Table: table, Column: v.Name, Err: errs[k]}
+		}
+		if v.Name == TenantColumn {
+			return &SchemaError{Table: table, Column: v.Name, Err: ErrTenantMigrationNotSupported}
+		}
+	}
+	for _, v := range columns {
+		_, err = u.DB.Exec(dialect.addColumn(table, v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *User) verifyAuditTable() error {
+	if !u.AuditEnabled() {
+		return nil
+	}
+	return u.VerifyTable(u.AuditTableName(), u.AuditSchema())
+}
@@ -2,6 +2,7 @@ package sqlusersystem
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -76,6 +77,15 @@ type Tables struct {
 	PasswordMapperName string
 	TokenMapperName    string
 	UserMapperName     string
+	//AuditMapperName audit log table name.
+	//Audit log will not be written if empty.
+	AuditMapperName string
+	//TOTPMapperName totp secret table name.
+	TOTPMapperName string
+	//RecoveryCodeMapperName recovery code table name.
+	RecoveryCodeMapperName string
+	//APIKeyMapperName api key table name.
+	APIKeyMapperName string
 }
 
 //RandomBytes string generater return random bytes.
@@ -118,6 +128,32 @@ type User struct {
 	PasswordKey string
 	//QueryBuilder sql query builder
 	QueryBuilder *querybuilder.Builder
+	//MultiTenant whether tables are scoped by tenant column.
+	//default value is false.
+	MultiTenant bool
+	//Tenant default tenant used when tenant not found in context.
+	Tenant string
+	//ContextLoader loader of context used when tenant or audit info not found in mapper context.
+	//Mappers installed by Config.Execute have no context,
+	//set this loader by Config.InstallTo to supply tenant and audit info for them.
+	//default value is nil.
+	ContextLoader func() context.Context
+	//AuditActor default actor recorded in audit log when not found in context.
+	AuditActor string
+	//AuditReason default reason recorded in audit log when not found in context.
+	AuditReason string
+	//Keyring keyring used to encrypt sensitive columns.
+	//Columns will be stored in plaintext if nil.
+	//Existing plaintext records should be migrated by AccountMapper.Reencrypt after keyring set,
+	//and are read back as is until migrated.
+	Keyring *Keyring
+	//AutoMigrate whether create missing tables and columns when mappers start.
+	//default value is false.
+	AutoMigrate bool
+	//RevokeAPIKeysOnNewTerm whether revoke all api keys of user when new term started.
+	//Api keys will not be revoked if api key table name is empty.
+	//default value is false.
+	RevokeAPIKeysOnNewTerm bool
 }
 
 //AddTablePrefix add prefix to user table names.
@@ -126,6 +162,18 @@ func (u *User) AddTablePrefix(prefix string) {
 	u.Tables.PasswordMapperName = prefix + u.Tables.PasswordMapperName
 	u.Tables.TokenMapperName = prefix + u.Tables.TokenMapperName
 	u.Tables.UserMapperName = prefix + u.Tables.UserMapperName
+	if u.Tables.AuditMapperName != "" {
+		u.Tables.AuditMapperName = prefix + u.Tables.AuditMapperName
+	}
+	if u.Tables.TOTPMapperName != "" {
+		u.Tables.TOTPMapperName = prefix + u.Tables.TOTPMapperName
+	}
+	if u.Tables.RecoveryCodeMapperName != "" {
+		u.Tables.RecoveryCodeMapperName = prefix + u.Tables.RecoveryCodeMapperName
+	}
+	if u.Tables.APIKeyMapperName != "" {
+		u.Tables.APIKeyMapperName = prefix + u.Tables.APIKeyMapperName
+	}
 }
 
 //AccountTableName return actual account database table name.
@@ -148,6 +196,41 @@ func (u *User) UserTableName() string {
 	return u.DB.BuildTableName(u.Tables.UserMapperName)
 }
 
+//AuditTableName return actual audit log database table name.
+func (u *User) AuditTableName() string {
+	return u.DB.BuildTableName(u.Tables.AuditMapperName)
+}
+
+//Audit return audit log mapper
+func (u *User) Audit() *AuditMapper {
+	return &AuditMapper{
+		ModelMapper: modelmapper.New(db.NewTable(u.DB, u.Tables.AuditMapperName)),
+		User:        u,
+	}
+}
+
+//AuditEnabled return if audit log enabled.
+func (u *User) AuditEnabled() bool {
+	return u.Tables.AuditMapperName != ""
+}
+
+func (u *User) loadContext() context.Context {
+	if u.ContextLoader == nil {
+		return nil
+	}
+	return u.ContextLoader()
+}
+
+func (u *User) audit(ctx context.Context, tx *sql.Tx, model *AuditModel) error {
+	if !u.AuditEnabled() {
+		return nil
+	}
+	info := u.AuditInfoFromContext(ctx)
+	model.Actor = info.Actor
+	model.Reason = info.Reason
+	return u.Audit().WithContext(ctx).Insert(tx, model)
+}
+
 //Account return account mapper
 func (u *User) Account() *AccountMapper {
 	return &AccountMapper{
@@ -184,6 +267,16 @@ func (u *User) User() *UserMapper {
 type AccountMapper struct {
 	*modelmapper.ModelMapper
 	User *User
+	//Context context used to load audit info.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+//Audit info in context will be recorded in audit log.
+func (a *AccountMapper) WithContext(ctx context.Context) *AccountMapper {
+	m := *a
+	m.Context = ctx
+	return &m
 }
 
 //MustAccounts return accounts of give uid.
@@ -192,8 +285,11 @@ func (a *AccountMapper) MustAccounts(uid string) *user.Accounts {
 	var result = []*user.Account{}
 	Select := query.NewSelectQuery()
 	Select.Select.Add("account.keyword", "account.account")
+	if a.User.Keyring != nil {
+		Select.Select.Add("account.account_encrypted")
+	}
 	Select.From.AddAlias("account", a.TableName())
-	Select.Where.Condition = query.Equal("account.uid", uid)
+	Select.Where.Condition = a.User.scope(a.Context, "account."+TenantColumn, query.Equal("account.uid", uid))
 	rows, err := Select.QueryRows(a.DB())
 	if err != nil {
 		panic(err)
@@ -201,13 +297,24 @@ func (a *AccountMapper) MustAccounts(uid string) *user.Accounts {
 	defer rows.Close()
 	for rows.Next() {
 		v := user.NewAccount()
-		err := Select.Result().
+		var encrypted string
+		r := Select.Result().
 			Bind("account.keyword", &v.Keyword).
-			Bind("account.account", &v.Account).
-			ScanFrom(rows)
+			Bind("account.account", &v.Account)
+		if a.User.Keyring != nil {
+			r = r.Bind("account.account_encrypted", &encrypted)
+		}
+		err := r.ScanFrom(rows)
 		if err != nil {
 			panic(err)
 		}
+		//Plaintext records not re-encrypted yet contain no key id and are read back as is.
+		if id, _ := KeyIDOf(encrypted); id != "" {
+			v.Account, err = a.User.Keyring.DecryptString(encrypted)
+			if err != nil {
+				panic(err)
+			}
+		}
 		result = append(result, v)
 	}
 	accounts := user.Accounts(result)
@@ -227,8 +334,14 @@ func (a *AccountMapper) MustAccountToUID(account *user.Account) (uid string) {
 	return model.UID
 }
 
+//Start start service.
+//Account table schema will be verified.
 func (a *AccountMapper) Start() error {
-	return nil
+	err := a.User.VerifyTable(a.User.AccountTableName(), a.User.AccountSchema())
+	if err != nil {
+		return err
+	}
+	return a.User.verifyAuditTable()
 }
 
 //Stop stop service
@@ -241,17 +354,35 @@ func (a *AccountMapper) Purge(string) error {
 	return nil
 }
 
+//index return value stored in account column of given account.
+//Blind index will be returned if keyring is set.
+func (a *AccountMapper) index(keyword string, account string) (string, error) {
+	if a.User.Keyring == nil {
+		return account, nil
+	}
+	return a.User.Keyring.BlindIndex(keyword, account)
+}
+
 //Unbind unbind account from user.
 //Return any error if raised.
 func (a *AccountMapper) Unbind(uid string, account *user.Account) error {
 	query := a.User.QueryBuilder
+	index, err := a.index(account.Keyword, account.Account)
+	if err != nil {
+		return err
+	}
+	tx, err := a.DB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 	Delete := query.NewDeleteQuery(a.TableName())
-	Delete.Where.Condition = query.And(
+	Delete.Where.Condition = a.User.scope(a.Context, "account."+TenantColumn,
 		query.Equal("account.uid", uid),
 		query.Equal("account.keyword", account.Keyword),
-		query.Equal("account.account", account.Account),
+		query.Equal("account.account", index),
 	)
-	r, err := Delete.Query().Exec(a.DB())
+	r, err := Delete.Query().Exec(tx)
 	if err != nil {
 		return err
 	}
@@ -262,7 +393,14 @@ func (a *AccountMapper) Unbind(uid string, account *user.Account) error {
 	if affected == 0 {
 		return user.ErrAccountUnbindingNotExists
 	}
-	return nil
+	model := NewAuditModel(a.Context, AuditEventUnbind, uid)
+	model.Keyword = account.Keyword
+	model.Account = index
+	err = a.User.audit(a.Context, tx, model)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 //Bind bind account to user.
@@ -270,6 +408,10 @@ func (a *AccountMapper) Unbind(uid string, account *user.Account) error {
 //If account exists, error user.ErrAccountBindingExists will raised.
 func (a *AccountMapper) Bind(uid string, account *user.Account) error {
 	query := a.User.QueryBuilder
+	index, err := a.index(account.Keyword, account.Account)
+	if err != nil {
+		return err
+	}
 	tx, err := a.DB().Begin()
 	if err != nil {
 		return err
@@ -279,9 +421,9 @@ func (a *AccountMapper) Bind(uid string, account *user.Account) error {
 	Select := query.NewSelectQuery()
 	Select.Select.Add("account.uid")
 	Select.From.AddAlias("account", a.TableName())
-	Select.Where.Condition = query.And(
+	Select.Where.Condition = a.User.scope(a.Context, TenantColumn,
 		query.Equal("keyword", account.Keyword),
-		query.Equal("account", account.Account),
+		query.Equal("account", index),
 	)
 	row := Select.QueryRow(a.DB())
 	err = row.Scan(&u)
@@ -299,12 +441,29 @@ func (a *AccountMapper) Bind(uid string, account *user.Account) error {
 	Insert.Insert.
 		Add("uid", uid).
 		Add("keyword", account.Keyword).
-		Add("account", account.Account).
+		Add("account", index).
 		Add("created_time", CreatedTime)
+	if a.User.Keyring != nil {
+		encrypted, err := a.User.Keyring.EncryptString(account.Account)
+		if err != nil {
+			return err
+		}
+		Insert.Insert.Add("account_encrypted", encrypted)
+	}
+	if a.User.MultiTenant {
+		Insert.Insert.Add(TenantColumn, a.User.TenantFromContext(a.Context))
+	}
 	_, err = Insert.Query().Exec(tx)
 	if err != nil {
 		return err
 	}
+	model := NewAuditModel(a.Context, AuditEventBind, uid)
+	model.Keyword = account.Keyword
+	model.Account = index
+	err = a.User.audit(a.Context, tx, model)
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -318,21 +477,139 @@ func (a *AccountMapper) Find(keyword string, account string) (*AccountModel, err
 	if account == "" {
 		return nil, sql.ErrNoRows
 	}
+	index, err := a.index(keyword, account)
+	if err != nil {
+		return nil, err
+	}
 	Select := query.NewSelectQuery()
 	Select.Select.Add("uid", "keyword", "account", "created_time")
 	Select.From.Add(a.TableName())
-	Select.Where.Condition = query.And(
+	Select.Where.Condition = a.User.scope(a.Context, TenantColumn,
 		query.Equal("keyword", keyword),
-		query.Equal("account", account),
+		query.Equal("account", index),
 	)
 	row := Select.QueryRow(a.DB())
-	err := Select.Result().
+	err = Select.Result().
 		Bind("uid", &result.UID).
 		Bind("keyword", &result.Keyword).
 		Bind("account", &result.Account).
 		Bind("created_time", &result.CreatedTime).
 		ScanFrom(row)
-	return result, err
+	if err != nil {
+		return result, err
+	}
+	result.Account = account
+	return result, nil
+}
+
+//Reencrypt re-encrypt at most limit account records which not encrypted by current key.
+//Plaintext records will be encrypted and indexed.
+//Records of all tenants will be processed.
+//Call Reencrypt repeatedly until zero returned to rotate all records.
+//Return processed records count and any error if raised.
+func (a *AccountMapper) Reencrypt(limit int) (int, error) {
+	keyring := a.User.Keyring
+	if keyring == nil {
+		return 0, ErrKeyNotFound
+	}
+	err := ValidateKeyID(keyring.Current)
+	if err != nil {
+		return 0, err
+	}
+	query := a.User.QueryBuilder
+	Select := query.NewSelectQuery()
+	Select.Select.Add("account.uid", "account.keyword", "account.account", "account.account_encrypted")
+	if a.User.MultiTenant {
+		Select.Select.Add("account." + TenantColumn)
+	}
+	Select.From.AddAlias("account", a.TableName())
+	Select.Where.Condition = query.New("account.account_encrypted NOT LIKE ?", keyring.Current+":%")
+	if limit != 0 {
+		Select.Limit.Limit = &limit
+	}
+	rows, err := Select.QueryRows(a.DB())
+	if err != nil {
+		return 0, err
+	}
+	var models = []*AccountModel{}
+	var encrypted = []string{}
+	var tenants = []string{}
+	for rows.Next() {
+		v := &AccountModel{}
+		var e string
+		var tenant string
+		result := Select.Result().
+			Bind("account.uid", &v.UID).
+			Bind("account.keyword", &v.Keyword).
+			Bind("account.account", &v.Account).
+			Bind("account.account_encrypted", &e)
+		if a.User.MultiTenant {
+			result = result.Bind("account."+TenantColumn, &tenant)
+		}
+		err = result.ScanFrom(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		models = append(models, v)
+		encrypted = append(encrypted, e)
+		tenants = append(tenants, tenant)
+	}
+	rows.Close()
+	for k, v := range models {
+		var plain = v.Account
+		var index = v.Account
+		if encrypted[k] != "" {
+			plain, err = keyring.DecryptString(encrypted[k])
+			if err != nil {
+				return k, err
+			}
+		} else {
+			index, err = keyring.BlindIndex(v.Keyword, plain)
+			if err != nil {
+				return k, err
+			}
+		}
+		e, err := keyring.EncryptString(plain)
+		if err != nil {
+			return k, err
+		}
+		Update := query.NewUpdateQuery(a.TableName())
+		Update.Update.
+			Add("account", index).
+			Add("account_encrypted", e)
+		conditions := []*querybuilder.PlainQuery{
+			query.Equal("uid", v.UID),
+			query.Equal("keyword", v.Keyword),
+			query.Equal("account", v.Account),
+			query.Equal("account_encrypted", encrypted[k]),
+		}
+		if a.User.MultiTenant {
+			conditions = append(conditions, query.Equal(TenantColumn, tenants[k]))
+		}
+		Update.Where.Condition = query.And(conditions...)
+		_, err = Update.Query().Exec(a.DB())
+		if err != nil {
+			return k, err
+		}
+	}
+	return len(models), nil
+}
+
+//MustReencryptAll re-encrypt all account records which not encrypted by current key in batches.
+//Return processed records count.
+func (a *AccountMapper) MustReencryptAll(batch int) int {
+	var total int
+	for {
+		count, err := a.Reencrypt(batch)
+		if err != nil {
+			panic(err)
+		}
+		if count == 0 {
+			return total
+		}
+		total = total + count
+	}
 }
 
 //MustBindAccount bind account to user.
@@ -368,11 +645,26 @@ type AccountModel struct {
 type PasswordMapper struct {
 	*modelmapper.ModelMapper
 	User *User
+	//Context context used to load audit info.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+//Audit info in context will be recorded in audit log.
+func (p *PasswordMapper) WithContext(ctx context.Context) *PasswordMapper {
+	m := *p
+	m.Context = ctx
+	return &m
 }
 
-//Start start service
+//Start start service.
+//Password table schema will be verified.
 func (p *PasswordMapper) Start() error {
-	return nil
+	err := p.User.VerifyTable(p.User.PasswordTableName(), p.User.PasswordSchema())
+	if err != nil {
+		return err
+	}
+	return p.User.verifyAuditTable()
 }
 
 //Stop stop service
@@ -401,7 +693,7 @@ func (p *PasswordMapper) Find(uid string) (PasswordModel, error) {
 	Select := query.NewSelectQuery()
 	Select.Select.Add("password.hash_method", "password.salt", "password.password", "password.updated_time")
 	Select.From.AddAlias("password", p.TableName())
-	Select.Where.Condition = query.Equal("uid", uid)
+	Select.Where.Condition = p.User.scope(p.Context, TenantColumn, query.Equal("uid", uid))
 	q := Select.Query()
 	row := p.DB().QueryRow(q.QueryCommand(), q.QueryArgs()...)
 	result.UID = uid
@@ -432,7 +724,7 @@ func (p *PasswordMapper) InsertOrUpdate(model *PasswordModel) error {
 		Add("salt", model.Salt).
 		Add("password", model.Password).
 		Add("updated_time", model.UpdatedTime)
-	Update.Where.Condition = query.Equal("uid", model.UID)
+	Update.Where.Condition = p.User.scope(p.Context, TenantColumn, query.Equal("uid", model.UID))
 	r, err := Update.Query().Exec(tx)
 
 	if err != nil {
@@ -442,6 +734,10 @@ func (p *PasswordMapper) InsertOrUpdate(model *PasswordModel) error {
 	if err != nil {
 		return err
 	}
+	err = p.User.audit(p.Context, tx, NewAuditModel(p.Context, AuditEventPassword, model.UID))
+	if err != nil {
+		return err
+	}
 	if affected != 0 {
 		return tx.Commit()
 	}
@@ -452,6 +748,9 @@ func (p *PasswordMapper) InsertOrUpdate(model *PasswordModel) error {
 		Add("salt", model.Salt).
 		Add("password", model.Password).
 		Add("updated_time", model.UpdatedTime)
+	if p.User.MultiTenant {
+		Insert.Insert.Add(TenantColumn, p.User.TenantFromContext(p.Context))
+	}
 	_, err = Insert.Query().Exec(tx)
 	if err != nil {
 		return err
@@ -525,6 +824,16 @@ type PasswordModel struct {
 type TokenMapper struct {
 	*modelmapper.ModelMapper
 	User *User
+	//Context context used to load audit info.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+//Audit info in context will be recorded in audit log.
+func (t *TokenMapper) WithContext(ctx context.Context) *TokenMapper {
+	m := *t
+	m.Context = ctx
+	return &m
 }
 
 func (t *TokenMapper) MustCurrentTerm(uid string) string {
@@ -532,7 +841,7 @@ func (t *TokenMapper) MustCurrentTerm(uid string) string {
 	Select := query.NewSelectQuery()
 	Select.Select.Add("token.token")
 	Select.From.AddAlias("token", t.TableName())
-	Select.Where.Condition = query.Equal("token.uid", uid)
+	Select.Where.Condition = t.User.scope(t.Context, "token."+TenantColumn, query.Equal("token.uid", uid))
 	row := Select.QueryRow(t.DB())
 	var token string
 	err := row.Scan(&token)
@@ -556,9 +865,14 @@ func (t *TokenMapper) MustStartNewTerm(uid string) string {
 	return token
 }
 
-//Start start service
+//Start start service.
+//Token table schema will be verified.
 func (t *TokenMapper) Start() error {
-	return nil
+	err := t.User.VerifyTable(t.User.TokenTableName(), t.User.TokenSchema())
+	if err != nil {
+		return err
+	}
+	return t.User.verifyAuditTable()
 }
 
 //Stop stop service
@@ -585,7 +899,7 @@ func (t *TokenMapper) InsertOrUpdate(uid string, token string) error {
 	Update.Update.
 		Add("token", token).
 		Add("updated_time", CreatedTime)
-	Update.Where.Condition = query.Equal("uid", uid)
+	Update.Where.Condition = t.User.scope(t.Context, TenantColumn, query.Equal("uid", uid))
 	r, err := Update.Query().Exec(tx)
 	if err != nil {
 		return err
@@ -594,6 +908,16 @@ func (t *TokenMapper) InsertOrUpdate(uid string, token string) error {
 	if err != nil {
 		return err
 	}
+	err = t.User.audit(t.Context, tx, NewAuditModel(t.Context, AuditEventTerm, uid))
+	if err != nil {
+		return err
+	}
+	if t.User.RevokeAPIKeysOnNewTerm && t.User.Tables.APIKeyMapperName != "" {
+		err = t.User.APIKey().WithContext(t.Context).RevokeAll(tx, uid)
+		if err != nil {
+			return err
+		}
+	}
 	if affected != 0 {
 		return tx.Commit()
 	}
@@ -602,6 +926,9 @@ func (t *TokenMapper) InsertOrUpdate(uid string, token string) error {
 		Add("uid", uid).
 		Add("token", token).
 		Add("updated_time", CreatedTime)
+	if t.User.MultiTenant {
+		Insert.Insert.Add(TenantColumn, t.User.TenantFromContext(t.Context))
+	}
 	_, err = Insert.Query().Exec(tx)
 	if err != nil {
 		return err
@@ -623,6 +950,16 @@ type TokenModel struct {
 type UserMapper struct {
 	*modelmapper.ModelMapper
 	User *User
+	//Context context used to load audit info.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+//Audit info in context will be recorded in audit log.
+func (u *UserMapper) WithContext(ctx context.Context) *UserMapper {
+	m := *u
+	m.Context = ctx
+	return &m
 }
 
 //IsAvailable check is status available
@@ -642,7 +979,7 @@ func (u *UserMapper) MustLoadStatus(uid string) (status.Status, bool) {
 	Select := query.NewSelectQuery()
 	Select.Select.Add("user.status")
 	Select.From.AddAlias("user", u.TableName())
-	Select.Where.Condition = query.Equal("user.uid", uid)
+	Select.Where.Condition = u.User.scope(u.Context, "user."+TenantColumn, query.Equal("user.uid", uid))
 	row := Select.QueryRow(u.DB())
 	err := row.Scan(&userstatus)
 	if err != nil {
@@ -660,12 +997,26 @@ func (u *UserMapper) MustUpdateStatus(uid string, userstatus status.Status) {
 		panic(err)
 	}
 	defer tx.Rollback()
+	var oldstatus = status.StatusUnkown
+	if u.User.AuditEnabled() {
+		Select := query.NewSelectQuery()
+		Select.Select.Add("user.status")
+		Select.From.AddAlias("user", u.TableName())
+		Select.Where.Condition = u.User.scope(u.Context, "user."+TenantColumn, query.Equal("user.uid", uid))
+		err = Select.QueryRow(tx).Scan(&oldstatus)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				panic(user.ErrUserNotExists)
+			}
+			panic(err)
+		}
+	}
 	var CreatedTime = time.Now().Unix()
 	Update := query.NewUpdateQuery(u.TableName())
 	Update.Update.
 		Add("status", userstatus).
 		Add("updated_time", CreatedTime)
-	Update.Where.Condition = query.Equal("uid", uid)
+	Update.Where.Condition = u.User.scope(u.Context, TenantColumn, query.Equal("uid", uid))
 	r, err := Update.Query().Exec(tx)
 	if err != nil {
 		panic(err)
@@ -675,6 +1026,13 @@ func (u *UserMapper) MustUpdateStatus(uid string, userstatus status.Status) {
 		panic(err)
 	}
 	if affected != 0 {
+		model := NewAuditModel(u.Context, AuditEventStatus, uid)
+		model.OldStatus = oldstatus
+		model.NewStatus = userstatus
+		err = u.User.audit(u.Context, tx, model)
+		if err != nil {
+			panic(err)
+		}
 		err = tx.Commit()
 		if err != nil {
 			panic(err)
@@ -697,6 +1055,9 @@ func (u *UserMapper) MustCreateStatus(uid string) {
 		Add("status", status.StatusUnkown).
 		Add("updated_time", CreatedTime).
 		Add("created_time", CreatedTime)
+	if u.User.MultiTenant {
+		Insert.Insert.Add(TenantColumn, u.User.TenantFromContext(u.Context))
+	}
 	_, err = Insert.Query().Exec(tx)
 	if err != nil {
 		if query.IsDuplicate(err) {
@@ -712,7 +1073,7 @@ func (u *UserMapper) MustCreateStatus(uid string) {
 func (u *UserMapper) MustRemoveStatus(uid string) {
 	query := u.User.QueryBuilder
 	Delete := query.NewDeleteQuery(u.TableName())
-	Delete.Where.Condition = query.Equal("uid", uid)
+	Delete.Where.Condition = u.User.scope(u.Context, TenantColumn, query.Equal("uid", uid))
 	result, err := Delete.Query().Exec(u.DB())
 	if err != nil {
 		panic(err)
@@ -730,11 +1091,18 @@ func (u *UserMapper) MustListUsersByStatus(last string, limit int, reverse bool,
 	Select := query.NewSelectQuery()
 	Select.Select.Add("user.uid")
 	Select.From.AddAlias("user", u.TableName())
+	if u.User.MultiTenant {
+		Select.Where.Condition = u.User.scope(u.Context, "user."+TenantColumn)
+	}
 	if last != "" {
+		var condition = query.New("user.uid > ?", last)
 		if reverse {
-			Select.Where.Condition = query.New("user.uid < ?", last)
+			condition = query.New("user.uid < ?", last)
+		}
+		if Select.Where.Condition == nil {
+			Select.Where.Condition = condition
 		} else {
-			Select.Where.Condition = query.New("user.uid > ?", last)
+			Select.Where.Condition = Select.Where.Condition.And(condition)
 		}
 	}
 	if len(statuses) > 0 {
@@ -763,8 +1131,15 @@ func (u *UserMapper) MustListUsersByStatus(last string, limit int, reverse bool,
 func (u *UserMapper) Purge(uid string) error {
 	return nil
 }
+
+//Start start service.
+//User table schema will be verified.
 func (u *UserMapper) Start() error {
-	return nil
+	err := u.User.VerifyTable(u.User.UserTableName(), u.User.UserSchema())
+	if err != nil {
+		return err
+	}
+	return u.User.verifyAuditTable()
 }
 func (u *UserMapper) Stop() error {
 	return nil
@@ -1,12 +1,18 @@
 package sqlusersystem
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/herb-go/datasource/sql/querybuilder"
 	"github.com/herb-go/herbsystem"
 	"github.com/herb-go/user/status"
 	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/apikey"
+	"github.com/herb-go/usersystem-drivers/totp"
 	"github.com/herb-go/usersystem/modules/useraccount"
 	"github.com/herb-go/usersystem/modules/userpassword"
 	"github.com/herb-go/usersystem/modules/userstatus"
@@ -42,6 +48,12 @@ func testConfig() *Config {
 	return &c
 }
 
+func testAuditConfig() *Config {
+	c := testConfig()
+	c.TableAuditLog = "audit_log"
+	return c
+}
+
 func flush() {
 	c := testConfig()
 	database := db.New()
@@ -279,3 +291,526 @@ func TestService(t *testing.T) {
 		t.Fatal(users)
 	}
 }
+
+func TestAudit(t *testing.T) {
+	InitDB()
+	var err error
+	sqluser := New()
+	err = testAuditConfig().ApplyToUser(sqluser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqluser.DB.Exec("TRUNCATE audit_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := "audituid"
+	ctx := ContextWithAuditInfo(context.Background(), "admin", "testreason")
+	sqluser.User().MustCreateStatus(uid)
+	sqluser.User().WithContext(ctx).MustUpdateStatus(uid, status.StatusBanned)
+	sqluser.Password().MustUpdatePassword(uid, "password")
+	sqluser.Token().MustStartNewTerm(uid)
+	acc := user.NewAccount()
+	acc.Account = "auditaccount"
+	sqluser.Account().WithContext(ctx).MustBindAccount(uid, acc)
+	sqluser.Account().MustUnbindAccount(uid, acc)
+	err = herbsystem.Catch(func() {
+		sqluser.Account().MustUnbindAccount(uid, acc)
+	})
+	if err != user.ErrAccountUnbindingNotExists {
+		t.Fatal(err)
+	}
+	logs := sqluser.Audit().MustFindByUID(uid, 0, 0, 0)
+	if len(logs) != 5 {
+		t.Fatal(logs)
+	}
+	events := map[string]*AuditModel{}
+	order := []string{AuditEventStatus, AuditEventPassword, AuditEventTerm, AuditEventBind, AuditEventUnbind}
+	for k, v := range logs {
+		if v.UID != uid || v.EventType != order[k] {
+			t.Fatal(v)
+		}
+		events[v.EventType] = v
+	}
+	if events[AuditEventStatus].OldStatus != status.StatusUnkown || events[AuditEventStatus].NewStatus != status.StatusBanned {
+		t.Fatal(events[AuditEventStatus])
+	}
+	if events[AuditEventStatus].Actor != "admin" || events[AuditEventStatus].Reason != "testreason" {
+		t.Fatal(events[AuditEventStatus])
+	}
+	if events[AuditEventBind].Account != "auditaccount" || events[AuditEventBind].Actor != "admin" {
+		t.Fatal(events[AuditEventBind])
+	}
+	if events[AuditEventUnbind].Account != "auditaccount" || events[AuditEventUnbind].Actor != "" {
+		t.Fatal(events[AuditEventUnbind])
+	}
+	if events[AuditEventPassword] == nil || events[AuditEventTerm] == nil {
+		t.Fatal(events)
+	}
+	logs = sqluser.Audit().MustFindByUID(uid, 0, 0, 2)
+	if len(logs) != 2 || logs[0].EventType != AuditEventStatus || logs[1].EventType != AuditEventPassword {
+		t.Fatal(logs)
+	}
+	logs = sqluser.Audit().MustFindByUID(uid, 0, events[AuditEventStatus].CreatedTime, 0)
+	if len(logs) != 0 {
+		t.Fatal(logs)
+	}
+	logs = sqluser.Audit().MustFindByUID("notexist", 0, 0, 0)
+	if len(logs) != 0 {
+		t.Fatal(logs)
+	}
+	c := testAuditConfig()
+	c.AuditActor = "system"
+	s := usersystem.New()
+	ustatus := userstatus.MustNewAndInstallTo(s)
+	upassword := userpassword.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	var current context.Context
+	serviceuser := New()
+	serviceuser.ContextLoader = func() context.Context {
+		return current
+	}
+	err = c.InstallTo(s, serviceuser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	uid = "auditserviceuid"
+	usercreate.MustExecCreate(s, uid)
+	current = ContextWithAuditInfo(context.Background(), "serviceadmin", "servicereason")
+	ustatus.MustUpdateStatus(uid, status.StatusBanned)
+	current = nil
+	upassword.MustUpdatePassword(uid, "password")
+	logs = serviceuser.Audit().MustFindByUID(uid, 0, 0, 0)
+	if len(logs) != 2 {
+		t.Fatal(logs)
+	}
+	if logs[0].EventType != AuditEventStatus || logs[0].Actor != "serviceadmin" || logs[0].Reason != "servicereason" {
+		t.Fatal(logs[0])
+	}
+	if logs[1].EventType != AuditEventPassword || logs[1].Actor != "system" || logs[1].Reason != "" {
+		t.Fatal(logs[1])
+	}
+}
+
+//TestTenant requires tables created by mysql/tenant/*.sql with "tenant_" prefix.
+func TestTenant(t *testing.T) {
+	var err error
+	c := testAuditConfig()
+	c.Prefix = "tenant_"
+	c.MultiTenant = true
+	c.Tenant = "tenant1"
+	sqluser := New()
+	err = c.ApplyToUser(sqluser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"account", "password", "token", "user", "audit_log"} {
+		_, err = sqluser.DB.Exec("TRUNCATE tenant_" + v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	uid := "tenantuid"
+	ctx := ContextWithTenant(context.Background(), "tenant2")
+	sqluser.User().MustCreateStatus(uid)
+	sqluser.User().WithContext(ctx).MustCreateStatus(uid)
+	err = herbsystem.Catch(func() {
+		sqluser.User().MustCreateStatus(uid)
+	})
+	if err != user.ErrUserExists {
+		t.Fatal(err)
+	}
+	sqluser.User().WithContext(ctx).MustUpdateStatus(uid, status.StatusBanned)
+	st, ok := sqluser.User().MustLoadStatus(uid)
+	if st != status.StatusUnkown || !ok {
+		t.Fatal(st)
+	}
+	st, ok = sqluser.User().WithContext(ctx).MustLoadStatus(uid)
+	if st != status.StatusBanned || !ok {
+		t.Fatal(st)
+	}
+	users := sqluser.User().MustListUsersByStatus("", 0, false, status.StatusBanned)
+	if len(users) != 0 {
+		t.Fatal(users)
+	}
+	users = sqluser.User().WithContext(ctx).MustListUsersByStatus("", 0, false, status.StatusBanned)
+	if len(users) != 1 {
+		t.Fatal(users)
+	}
+	sqluser.Password().MustUpdatePassword(uid, "password")
+	if !sqluser.Password().MustVerifyPassword(uid, "password") {
+		t.Fatal()
+	}
+	if sqluser.Password().WithContext(ctx).MustVerifyPassword(uid, "password") {
+		t.Fatal()
+	}
+	term := sqluser.Token().MustStartNewTerm(uid)
+	if sqluser.Token().WithContext(ctx).MustCurrentTerm(uid) != "" {
+		t.Fatal(term)
+	}
+	acc := user.NewAccount()
+	acc.Account = "tenantaccount"
+	sqluser.Account().MustBindAccount(uid, acc)
+	sqluser.Account().WithContext(ctx).MustBindAccount(uid, acc)
+	err = herbsystem.Catch(func() {
+		sqluser.Account().MustBindAccount(uid, acc)
+	})
+	if err != user.ErrAccountBindingExists {
+		t.Fatal(err)
+	}
+	sqluser.Account().MustUnbindAccount(uid, acc)
+	if sqluser.Account().MustAccountToUID(acc) != "" {
+		t.Fatal()
+	}
+	if sqluser.Account().WithContext(ctx).MustAccountToUID(acc) != uid {
+		t.Fatal()
+	}
+	logs := sqluser.Audit().WithContext(ctx).MustFindByUID(uid, 0, 0, 0)
+	if len(logs) != 2 {
+		t.Fatal(logs)
+	}
+	sqluser.User().MustRemoveStatus(uid)
+	_, ok = sqluser.User().WithContext(ctx).MustLoadStatus(uid)
+	if !ok {
+		t.Fatal(ok)
+	}
+	s := usersystem.New()
+	ustatus := userstatus.MustNewAndInstallTo(s)
+	uaccounts := useraccount.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	var current context.Context
+	serviceuser := New()
+	serviceuser.ContextLoader = func() context.Context {
+		return current
+	}
+	err = c.InstallTo(s, serviceuser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	_, ok = ustatus.MustLoadStatus(uid)
+	if ok {
+		t.Fatal(ok)
+	}
+	if uaccounts.MustAccountToUID(acc) != "" {
+		t.Fatal()
+	}
+	current = ctx
+	st, ok = ustatus.MustLoadStatus(uid)
+	if st != status.StatusBanned || !ok {
+		t.Fatal(st)
+	}
+	if uaccounts.MustAccountToUID(acc) != uid {
+		t.Fatal()
+	}
+}
+
+//TestEncryptedAccount requires account table altered by mysql/account_encrypted.sql.
+func TestEncryptedAccount(t *testing.T) {
+	InitDB()
+	var err error
+	plain := New()
+	err = testConfig().ApplyToUser(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig()
+	c.Encryption = &KeyringConfig{
+		Current:  "key1",
+		Keys:     map[string]string{"key1": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))},
+		IndexKey: base64.StdEncoding.EncodeToString([]byte("indexkey")),
+	}
+	encrypted := New()
+	err = c.ApplyToUser(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := "encrypteduid"
+	acc := user.NewAccount()
+	acc.Account = "encrypted@example.com"
+	plain.Account().MustBindAccount(uid, acc)
+	if encrypted.Account().MustAccountToUID(acc) != "" {
+		t.Fatal()
+	}
+	accounts := encrypted.Account().MustAccounts(uid)
+	if len(accounts.Data()) != 1 || accounts.Data()[0].Account != acc.Account {
+		t.Fatal(accounts)
+	}
+	count := encrypted.Account().MustReencryptAll(10)
+	if count != 1 {
+		t.Fatal(count)
+	}
+	if plain.Account().MustAccountToUID(acc) != "" {
+		t.Fatal()
+	}
+	if encrypted.Account().MustAccountToUID(acc) != uid {
+		t.Fatal()
+	}
+	accounts = encrypted.Account().MustAccounts(uid)
+	if len(accounts.Data()) != 1 || accounts.Data()[0].Account != acc.Account {
+		t.Fatal(accounts)
+	}
+	c.Encryption.Keys["key2"] = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210"))
+	c.Encryption.Current = "key2"
+	err = c.ApplyToUser(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count = encrypted.Account().MustReencryptAll(10)
+	if count != 1 {
+		t.Fatal(count)
+	}
+	count = encrypted.Account().MustReencryptAll(10)
+	if count != 0 {
+		t.Fatal(count)
+	}
+	delete(encrypted.Keyring.Keys, "key1")
+	accounts = encrypted.Account().MustAccounts(uid)
+	if len(accounts.Data()) != 1 || accounts.Data()[0].Account != acc.Account {
+		t.Fatal(accounts)
+	}
+	encrypted.Account().MustUnbindAccount(uid, acc)
+	if encrypted.Account().MustAccountToUID(acc) != "" {
+		t.Fatal()
+	}
+}
+
+func TestEncryptedTenantAccount(t *testing.T) {
+	var err error
+	c := testConfig()
+	c.Prefix = "tenant_"
+	c.MultiTenant = true
+	c.Tenant = "tenant1"
+	c.AutoMigrate = true
+	c.Encryption = &KeyringConfig{
+		Current:  "key1",
+		Keys:     map[string]string{"key1": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))},
+		IndexKey: base64.StdEncoding.EncodeToString([]byte("indexkey")),
+	}
+	encrypted := New()
+	err = c.ApplyToUser(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = encrypted.Account().Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = encrypted.DB.Exec("TRUNCATE tenant_account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Encryption = nil
+	plain := New()
+	err = c.ApplyToUser(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := "tenantuid"
+	ctx := ContextWithTenant(context.Background(), "tenant2")
+	acc := user.NewAccount()
+	acc.Account = "tenant@example.com"
+	plain.Account().MustBindAccount(uid, acc)
+	plain.Account().WithContext(ctx).MustBindAccount(uid, acc)
+	count, err := encrypted.Account().Reencrypt(1)
+	if err != nil || count != 1 {
+		t.Fatal(count, err)
+	}
+	var unencrypted int
+	err = encrypted.DB.QueryRow("SELECT COUNT(*) FROM tenant_account WHERE account_encrypted = ''").Scan(&unencrypted)
+	if err != nil || unencrypted != 1 {
+		t.Fatal(unencrypted, err)
+	}
+	count = encrypted.Account().MustReencryptAll(10)
+	if count != 1 {
+		t.Fatal(count)
+	}
+	if encrypted.Account().MustAccountToUID(acc) != uid {
+		t.Fatal()
+	}
+	if encrypted.Account().WithContext(ctx).MustAccountToUID(acc) != uid {
+		t.Fatal()
+	}
+}
+
+func TestSchema(t *testing.T) {
+	var err error
+	c := testConfig()
+	c.Prefix = "schema_"
+	sqluser := New()
+	err = c.ApplyToUser(sqluser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []string{"account", "password", "token", "user", "audit_log"}
+	dropTables := func() {
+		for _, v := range tables {
+			sqluser.DB.Exec("DROP TABLE IF EXISTS schema_" + v)
+		}
+	}
+	dropTables()
+	defer dropTables()
+	var schemaerr *SchemaError
+	err = sqluser.User().Start()
+	if !errors.As(err, &schemaerr) || schemaerr.Table != "schema_user" || schemaerr.Column != "" {
+		t.Fatal(err)
+	}
+	c.AutoMigrate = true
+	err = c.ApplyToUser(sqluser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []func() error{sqluser.Account().Start, sqluser.Password().Start, sqluser.Token().Start, sqluser.User().Start} {
+		err = v()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sqluser.User().MustCreateStatus("schemauid")
+	sqluser.Password().MustUpdatePassword("schemauid", "password")
+	c.AutoMigrate = false
+	c.MultiTenant = true
+	err = c.ApplyToUser(sqluser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqluser.Token().Start()
+	if !errors.As(err, &schemaerr) || schemaerr.Table != "schema_token" || schemaerr.Column != TenantColumn {
+		t.Fatal(err)
+	}
+	c.AutoMigrate = true
+	err = c.ApplyToUser(sqluser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqluser.Token().Start()
+	if !errors.As(err, &schemaerr) || schemaerr.Table != "schema_token" || schemaerr.Column != TenantColumn || !errors.Is(err, ErrTenantMigrationNotSupported) {
+		t.Fatal(err)
+	}
+	err = sqluser.checkTable("schema_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := sqluser.DB.Query("SELECT " + TenantColumn + " FROM schema_token WHERE 1=0")
+	if err == nil {
+		rows.Close()
+		t.Fatal(err)
+	}
+	_, err = sqluser.DB.Exec("DROP TABLE schema_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqluser.Token().Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqluser.Token().WithContext(ContextWithTenant(context.Background(), "")).MustStartNewTerm("schemauid")
+}
+
+func TestTOTP(t *testing.T) {
+	var err error
+	c := testConfig()
+	c.TableTOTP = "totp"
+	c.AutoMigrate = true
+	c.Encryption = &KeyringConfig{
+		Current:  "key1",
+		Keys:     map[string]string{"key1": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))},
+		IndexKey: base64.StdEncoding.EncodeToString([]byte("indexkey")),
+	}
+	c.TableAccount = ""
+	s := usersystem.New()
+	service := totp.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	err = c.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	store := service.Store.(*TOTPMapper)
+	store.MustRemoveTOTP("totpuid")
+	e := service.MustEnroll("totpuid")
+	var raw string
+	err = store.DB().QueryRow("SELECT secret FROM "+store.TableName()+" WHERE uid = ?", "totpuid").Scan(&raw)
+	if err != nil || raw == e.Secret {
+		t.Fatal(raw, err)
+	}
+	key, err := totp.DecodeSecret(e.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totp.HOTP(key, totp.Counter(time.Now(), service.Period), service.Digits)
+	if !service.MustConfirm("totpuid", code) {
+		t.Fatal()
+	}
+	if service.MustVerify("totpuid", code) {
+		t.Fatal()
+	}
+	if !service.MustEnabled("totpuid") {
+		t.Fatal()
+	}
+	_, err = store.DB().Exec("UPDATE "+store.TableName()+" SET secret = ? WHERE uid = ?", e.Secret, "totpuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := store.MustLoadTOTP("totpuid")
+	if secret == nil || secret.Secret != e.Secret {
+		t.Fatal(secret)
+	}
+	if store.MustReencryptAll(10) != 1 {
+		t.Fatal()
+	}
+	secret = store.MustLoadTOTP("totpuid")
+	if secret == nil || secret.Secret != e.Secret {
+		t.Fatal(secret)
+	}
+	service.MustDisable("totpuid")
+	if service.MustEnabled("totpuid") {
+		t.Fatal()
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	var err error
+	c := testConfig()
+	c.TableAPIKey = "api_key"
+	c.AutoMigrate = true
+	c.RevokeAPIKeysOnNewTerm = true
+	s := usersystem.New()
+	service := apikey.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	err = c.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	store := service.Store.(*APIKeyMapper)
+	store.MustRevokeAllAPIKeys("apikeyuid")
+	key, k := service.MustIssue("apikeyuid", "test", []string{"read", "write"}, 0)
+	uid, scopes := service.MustLookup(key)
+	if uid != "apikeyuid" || len(scopes) != 2 || scopes[1] != "write" {
+		t.Fatal(uid, scopes)
+	}
+	list := service.MustList("apikeyuid")
+	if len(list) != 1 || list[0].ID != k.ID || list[0].LastUsedTime == 0 {
+		t.Fatal(list)
+	}
+	u := New()
+	err = c.ApplyToUser(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Token().MustStartNewTerm("apikeyuid")
+	uid, _ = service.MustLookup(key)
+	if uid != "" {
+		t.Fatal(uid)
+	}
+}
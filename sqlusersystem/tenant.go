@@ -0,0 +1,55 @@
+package sqlusersystem
+
+import (
+	"context"
+
+	"github.com/herb-go/datasource/sql/querybuilder"
+)
+
+//TenantColumn database column name for tenant.
+var TenantColumn = "tenant"
+
+type tenantContextKey string
+
+//ContextKeyTenant context key for tenant.
+var ContextKeyTenant = tenantContextKey("tenant")
+
+//ContextWithTenant return new context with given tenant.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, ContextKeyTenant, tenant)
+}
+
+//GetTenant get tenant from context.
+//Return tenant and whether tenant found.
+func GetTenant(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenant, ok := ctx.Value(ContextKeyTenant).(string)
+	return tenant, ok
+}
+
+//TenantFromContext return tenant in given context.
+//Tenant in context loaded by user context loader will be used if not found in given context.
+//User tenant will be returned if tenant not found in both contexts.
+func (u *User) TenantFromContext(ctx context.Context) string {
+	tenant, ok := GetTenant(ctx)
+	if ok {
+		return tenant
+	}
+	tenant, ok = GetTenant(u.loadContext())
+	if ok {
+		return tenant
+	}
+	return u.Tenant
+}
+
+//scope join given conditions and tenant condition on given field with and operator.
+//Tenant condition will be ignored if multi tenant not enabled.
+func (u *User) scope(ctx context.Context, field string, conditions ...*querybuilder.PlainQuery) *querybuilder.PlainQuery {
+	query := u.QueryBuilder
+	if u.MultiTenant {
+		conditions = append(conditions, query.Equal(field, u.TenantFromContext(ctx)))
+	}
+	return query.And(conditions...)
+}
@@ -0,0 +1,306 @@
+package sqlusersystem
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/herb-go/datasource/sql/db"
+	"github.com/herb-go/datasource/sql/querybuilder"
+	"github.com/herb-go/datasource/sql/querybuilder/modelmapper"
+	"github.com/herb-go/usersystem-drivers/totp"
+)
+
+//TOTPTableName return actual totp database table name.
+func (u *User) TOTPTableName() string {
+	return u.DB.BuildTableName(u.Tables.TOTPMapperName)
+}
+
+//TOTP return totp mapper
+func (u *User) TOTP() *TOTPMapper {
+	return &TOTPMapper{
+		ModelMapper: modelmapper.New(db.NewTable(u.DB, u.Tables.TOTPMapperName)),
+		User:        u,
+	}
+}
+
+//TOTPSchema return totp table schema by user config.
+func (u *User) TOTPSchema() *TableSchema {
+	return &TableSchema{
+		Columns: u.tenantColumns(
+			&Column{Name: "uid", Type: ColumnTypeString},
+			&Column{Name: "secret", Type: ColumnTypeText},
+			&Column{Name: "confirmed", Type: ColumnTypeInt},
+			&Column{Name: "last_counter", Type: ColumnTypeBigInt},
+			&Column{Name: "created_time", Type: ColumnTypeBigInt},
+		),
+		PrimaryKey: u.tenantKeys("uid"),
+	}
+}
+
+//TOTPMapper totp mapper
+//Secret will be encrypted if user keyring set.
+type TOTPMapper struct {
+	*modelmapper.ModelMapper
+	User *User
+	//Context context used to load tenant.
+	Context context.Context
+}
+
+//WithContext return copy of mapper with given context.
+func (t *TOTPMapper) WithContext(ctx context.Context) *TOTPMapper {
+	m := *t
+	m.Context = ctx
+	return &m
+}
+
+//Start start service.
+//Totp table schema will be verified.
+func (t *TOTPMapper) Start() error {
+	return t.User.VerifyTable(t.User.TOTPTableName(), t.User.TOTPSchema())
+}
+
+//Stop stop service
+func (t *TOTPMapper) Stop() error {
+	return nil
+}
+
+//Find find totp secret by given uid.
+//Return secret and any error if raised.
+func (t *TOTPMapper) Find(uid string) (*totp.Secret, error) {
+	query := t.User.QueryBuilder
+	var result = &totp.Secret{}
+	var confirmed int
+	Select := query.NewSelectQuery()
+	Select.Select.Add("totp.secret", "totp.confirmed", "totp.last_counter", "totp.created_time")
+	Select.From.AddAlias("totp", t.TableName())
+	Select.Where.Condition = t.User.scope(t.Context, "totp."+TenantColumn, query.Equal("totp.uid", uid))
+	row := Select.QueryRow(t.DB())
+	err := Select.Result().
+		Bind("totp.secret", &result.Secret).
+		Bind("totp.confirmed", &confirmed).
+		Bind("totp.last_counter", &result.LastCounter).
+		Bind("totp.created_time", &result.CreatedTime).
+		ScanFrom(row)
+	if err != nil {
+		return nil, err
+	}
+	result.Confirmed = confirmed != 0
+	if t.User.Keyring != nil {
+		//Base32 encoded plaintext secret not re-encrypted yet contains no key id and is read back as is.
+		if id, _ := KeyIDOf(result.Secret); id != "" {
+			result.Secret, err = t.User.Keyring.DecryptString(result.Secret)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+//InsertOrUpdate insert or update totp secret of given uid.
+//Return any error if raised.
+func (t *TOTPMapper) InsertOrUpdate(uid string, secret *totp.Secret) error {
+	query := t.User.QueryBuilder
+	var err error
+	var data = secret.Secret
+	if t.User.Keyring != nil {
+		data, err = t.User.Keyring.EncryptString(data)
+		if err != nil {
+			return err
+		}
+	}
+	var confirmed int
+	if secret.Confirmed {
+		confirmed = 1
+	}
+	tx, err := t.DB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	Update := query.NewUpdateQuery(t.TableName())
+	Update.Update.
+		Add("secret", data).
+		Add("confirmed", confirmed).
+		Add("last_counter", secret.LastCounter).
+		Add("created_time", secret.CreatedTime)
+	Update.Where.Condition = t.User.scope(t.Context, TenantColumn, query.Equal("uid", uid))
+	r, err := Update.Query().Exec(tx)
+	if err != nil {
+		return err
+	}
+	affected, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 0 {
+		return tx.Commit()
+	}
+	Insert := query.NewInsertQuery(t.TableName())
+	Insert.Insert.
+		Add("uid", uid).
+		Add("secret", data).
+		Add("confirmed", confirmed).
+		Add("last_counter", secret.LastCounter).
+		Add("created_time", secret.CreatedTime)
+	if t.User.MultiTenant {
+		Insert.Insert.Add(TenantColumn, t.User.TenantFromContext(t.Context))
+	}
+	_, err = Insert.Query().Exec(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Reencrypt re-encrypt at most limit totp secrets which not encrypted by current key.
+//Plaintext secrets will be encrypted.
+//Records of all tenants will be processed.
+//Call Reencrypt repeatedly until zero returned to rotate all records.
+//Return processed records count and any error if raised.
+func (t *TOTPMapper) Reencrypt(limit int) (int, error) {
+	keyring := t.User.Keyring
+	if keyring == nil {
+		return 0, ErrKeyNotFound
+	}
+	err := ValidateKeyID(keyring.Current)
+	if err != nil {
+		return 0, err
+	}
+	query := t.User.QueryBuilder
+	Select := query.NewSelectQuery()
+	Select.Select.Add("totp.uid", "totp.secret")
+	if t.User.MultiTenant {
+		Select.Select.Add("totp." + TenantColumn)
+	}
+	Select.From.AddAlias("totp", t.TableName())
+	Select.Where.Condition = query.New("totp.secret NOT LIKE ?", keyring.Current+":%")
+	if limit != 0 {
+		Select.Limit.Limit = &limit
+	}
+	rows, err := Select.QueryRows(t.DB())
+	if err != nil {
+		return 0, err
+	}
+	var uids = []string{}
+	var secrets = []string{}
+	var tenants = []string{}
+	for rows.Next() {
+		var uid, secret, tenant string
+		result := Select.Result().
+			Bind("totp.uid", &uid).
+			Bind("totp.secret", &secret)
+		if t.User.MultiTenant {
+			result = result.Bind("totp."+TenantColumn, &tenant)
+		}
+		err = result.ScanFrom(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		uids = append(uids, uid)
+		secrets = append(secrets, secret)
+		tenants = append(tenants, tenant)
+	}
+	rows.Close()
+	for k, uid := range uids {
+		var plain = secrets[k]
+		//Base32 encoded plaintext secret contains no key id.
+		if id, _ := KeyIDOf(secrets[k]); id != "" {
+			plain, err = keyring.DecryptString(secrets[k])
+			if err != nil {
+				return k, err
+			}
+		}
+		e, err := keyring.EncryptString(plain)
+		if err != nil {
+			return k, err
+		}
+		Update := query.NewUpdateQuery(t.TableName())
+		Update.Update.
+			Add("secret", e)
+		conditions := []*querybuilder.PlainQuery{
+			query.Equal("uid", uid),
+			query.Equal("secret", secrets[k]),
+		}
+		if t.User.MultiTenant {
+			conditions = append(conditions, query.Equal(TenantColumn, tenants[k]))
+		}
+		Update.Where.Condition = query.And(conditions...)
+		_, err = Update.Query().Exec(t.DB())
+		if err != nil {
+			return k, err
+		}
+	}
+	return len(uids), nil
+}
+
+//MustReencryptAll re-encrypt all totp secrets which not encrypted by current key in batches.
+//Return processed records count.
+func (t *TOTPMapper) MustReencryptAll(batch int) int {
+	var total int
+	for {
+		count, err := t.Reencrypt(batch)
+		if err != nil {
+			panic(err)
+		}
+		if count == 0 {
+			return total
+		}
+		total = total + count
+	}
+}
+
+//MustLoadTOTP load totp secret of given uid.
+//Return nil if not found.
+func (t *TOTPMapper) MustLoadTOTP(uid string) *totp.Secret {
+	secret, err := t.Find(uid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		panic(err)
+	}
+	return secret
+}
+
+//MustSaveTOTP save totp secret of given uid.
+func (t *TOTPMapper) MustSaveTOTP(uid string, secret *totp.Secret) {
+	err := t.InsertOrUpdate(uid, secret)
+	if err != nil {
+		panic(err)
+	}
+}
+
+//MustRemoveTOTP remove totp secret of given uid.
+func (t *TOTPMapper) MustRemoveTOTP(uid string) {
+	query := t.User.QueryBuilder
+	Delete := query.NewDeleteQuery(t.TableName())
+	Delete.Where.Condition = t.User.scope(t.Context, TenantColumn, query.Equal("uid", uid))
+	_, err := Delete.Query().Exec(t.DB())
+	if err != nil {
+		panic(err)
+	}
+}
+
+//MustUseTOTPCounter set last used counter of given uid if counter larger than stored one.
+//Return whether counter updated.
+func (t *TOTPMapper) MustUseTOTPCounter(uid string, counter int64) bool {
+	query := t.User.QueryBuilder
+	Update := query.NewUpdateQuery(t.TableName())
+	Update.Update.
+		Add("last_counter", counter)
+	Update.Where.Condition = t.User.scope(t.Context, TenantColumn,
+		query.Equal("uid", uid),
+		query.New("last_counter < ?", counter),
+	)
+	r, err := Update.Query().Exec(t.DB())
+	if err != nil {
+		panic(err)
+	}
+	affected, err := r.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return affected != 0
+}
@@ -0,0 +1,77 @@
+package storemodule
+
+import (
+	"context"
+	"errors"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/usersystem"
+)
+
+//ErrModuleNotInstalled error raised when directive executed before module installed.
+var ErrModuleNotInstalled = errors.New("storemodule:module not installed")
+
+//Starter store which should be started when usersystem starts.
+type Starter interface {
+	Start() error
+}
+
+//Stopper store which should be stopped when usersystem stops.
+type Stopper interface {
+	Stop() error
+}
+
+//Module usersystem module which starts and stops store of driver service with usersystem.
+//Module should be embedded in module of driver service.
+type Module struct {
+	herbsystem.NopModule
+	name  string
+	store func() interface{}
+}
+
+//ModuleName return module name
+func (m *Module) ModuleName() string {
+	return m.name
+}
+
+//StartProcess start store if store implements Starter.
+func (m *Module) StartProcess(ctx context.Context, system herbsystem.System, next func(context.Context, herbsystem.System)) {
+	if s, ok := m.store().(Starter); ok {
+		err := s.Start()
+		if err != nil {
+			panic(err)
+		}
+	}
+	next(ctx, system)
+}
+
+//StopProcess stop store if store implements Stopper.
+func (m *Module) StopProcess(ctx context.Context, system herbsystem.System, next func(context.Context, herbsystem.System)) {
+	if s, ok := m.store().(Stopper); ok {
+		err := s.Stop()
+		if err != nil {
+			panic(err)
+		}
+	}
+	next(ctx, system)
+}
+
+//New create new module with given name and store getter.
+//Store getter will be called when usersystem starting and stopping.
+func New(name string, store func() interface{}) Module {
+	return Module{
+		name:  name,
+		store: store,
+	}
+}
+
+//MustInstallTo install given module to usersystem.
+func MustInstallTo(s *usersystem.UserSystem, m herbsystem.Module) {
+	s.MustRegisterSystemModule(m)
+}
+
+//MustGetModule get module installed to usersystem by given name.
+//Return nil if not installed.
+func MustGetModule(s *usersystem.UserSystem, name string) herbsystem.Module {
+	return herbsystem.MustGetConfigurableModule(s, name)
+}
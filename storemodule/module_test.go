@@ -0,0 +1,89 @@
+package storemodule
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/usersystem"
+)
+
+type testStore struct {
+	started int
+	stopped int
+}
+
+func (s *testStore) Start() error {
+	s.started++
+	return nil
+}
+
+func (s *testStore) Stop() error {
+	s.stopped++
+	return nil
+}
+
+type testModule struct {
+	Module
+	Store interface{}
+}
+
+func newTestModule() *testModule {
+	m := &testModule{}
+	m.Module = New("test", func() interface{} { return m.Store })
+	return m
+}
+
+var errTest = errors.New("test error")
+
+type testFailedStore struct{}
+
+func (s testFailedStore) Start() error {
+	return errTest
+}
+
+func TestModule(t *testing.T) {
+	s := usersystem.New()
+	m := newTestModule()
+	MustInstallTo(s, m)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	if MustGetModule(s, "test") != m {
+		t.Fatal()
+	}
+	if MustGetModule(s, "notexist") != nil {
+		t.Fatal()
+	}
+	store := &testStore{}
+	m.Store = store
+	herbsystem.MustStart(s)
+	if store.started != 1 || store.stopped != 0 {
+		t.Fatal(store)
+	}
+	herbsystem.MustStop(s)
+	if store.started != 1 || store.stopped != 1 {
+		t.Fatal(store)
+	}
+}
+
+func TestModuleWithoutStore(t *testing.T) {
+	s := usersystem.New()
+	m := newTestModule()
+	MustInstallTo(s, m)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	herbsystem.MustStart(s)
+	herbsystem.MustStop(s)
+	s = usersystem.New()
+	m = newTestModule()
+	m.Store = testFailedStore{}
+	MustInstallTo(s, m)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	err := herbsystem.Catch(func() {
+		herbsystem.MustStart(s)
+	})
+	if err != errTest {
+		t.Fatal(err)
+	}
+}
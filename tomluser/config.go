@@ -1,11 +1,22 @@
 package tomluser
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/usersystem/userpurge"
 
 	"github.com/herb-go/usersystem/modules/userprofile"
 
 	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/recoverycode"
+	"github.com/herb-go/usersystem-drivers/storemodule"
+	"github.com/herb-go/usersystem-drivers/totp"
 	"github.com/herb-go/usersystem/modules/useraccount"
 	"github.com/herb-go/usersystem/modules/userpassword"
 	"github.com/herb-go/usersystem/modules/userrole"
@@ -18,12 +29,34 @@ import (
 var locker sync.Mutex
 var registered = map[statictoml.Source]*Users{}
 
+//ErrConflictingOptions error raised when loading shared users with options different from loaded ones.
+var ErrConflictingOptions = errors.New("tomluser:users already loaded with different options")
+
+//Flush stop and remove all shared users from registry.
+//Watching of dropped users will be stopped and pending changes will be saved.
+//Users loaded after flushing will be reloaded from source.
 func Flush() {
 	locker.Lock()
-	locker.Unlock()
+	defer locker.Unlock()
+	for _, u := range registered {
+		err := u.stop()
+		if err != nil && u.OnSaveError != nil {
+			u.OnSaveError(err)
+		}
+	}
 	registered = map[statictoml.Source]*Users{}
 }
 
+//Release release users loaded by Config.Load.
+//Users are referenced by loads and started services,
+//and will be stopped and removed from registry when not referenced.
+//Return any error raised when saving pending changes.
+func Release(u *Users) error {
+	locker.Lock()
+	defer locker.Unlock()
+	return u.release()
+}
+
 type Data struct {
 	Users []*User
 }
@@ -33,37 +66,175 @@ func NewData() *Data {
 }
 
 type Config struct {
-	Source        statictoml.Source
-	Example       statictoml.Source
-	ProfileFields []string
-	ServePassword bool
-	ServeStatus   bool
-	ServeAccounts bool
-	ServeRoles    bool
-	ServeTerm     bool
-	ServeProfile  bool
+	//Source users source file,or directory in directory mode.
+	//Password,salt and totp secret of users in source can be secret references in "env:NAME" or "file:/run/secrets/x" format.
+	Source             statictoml.Source
+	Example            statictoml.Source
+	ProfileFields      []string
+	ServePassword      bool
+	ServeStatus        bool
+	ServeAccounts      bool
+	ServeRoles         bool
+	ServeTerm          bool
+	ServeProfile       bool
+	ServeTOTP          bool
+	ServeRecoveryCodes bool
+	HashMode           string
+	//Format source file format,"toml","json" or "yaml".
+	//Format will be detected by source file extension if empty.
+	Format string
+	//StrictHash whether unknown hash mode is an error.
+	StrictHash bool
+	//Watch whether reload source file when modified.
+	Watch bool
+	//WatchIntervalInSecond interval to check source file in second.
+	//DefaultWatchInterval will be used if zero.
+	WatchIntervalInSecond int64
+	//Backups number of rotating backups kept when saving.
+	Backups int
+	//SaveDelayInMillisecond delay in millisecond to batch changes before saving.
+	//Changes will be saved immediately if zero.
+	SaveDelayInMillisecond int64
+	//Directory whether source is a directory contains one file per user named by uid.
+	//Example will not be used in directory mode.
+	Directory bool
+	//ReadOnly whether source is read only.
+	//All mutations will fail with ErrReadOnly,
+	//and term,totp and recovery code services which need mutation will not be served.
+	//Source will not be created from example in read only mode.
+	ReadOnly bool
+	//ProfileSchema profile field schemas.
+	//Fields in schema will be served as profile fields,
+	//and profiles in source will be validated when loading.
+	ProfileSchema []*ProfileField
+}
+
+func (c *Config) options() *loadOptions {
+	o := &loadOptions{
+		Example:       string(c.Example),
+		Format:        c.Format,
+		Directory:     c.Directory,
+		ReadOnly:      c.ReadOnly,
+		StrictHash:    c.StrictHash,
+		HashMode:      c.HashMode,
+		Backups:       c.Backups,
+		SaveDelay:     time.Duration(c.SaveDelayInMillisecond) * time.Millisecond,
+		ProfileFields: append([]string{}, c.ProfileFields...),
+	}
+	if o.HashMode == "" {
+		o.HashMode = defaultUsersHashMode
+	}
+	if c.Watch {
+		o.WatchInterval = time.Duration(c.WatchIntervalInSecond) * time.Second
+		if o.WatchInterval <= 0 {
+			o.WatchInterval = DefaultWatchInterval
+		}
+	}
+	sort.Strings(o.ProfileFields)
+	for _, v := range c.ProfileSchema {
+		o.ProfileSchema = append(o.ProfileSchema, *v)
+	}
+	sort.Slice(o.ProfileSchema, func(i, j int) bool {
+		return o.ProfileSchema[i].Name < o.ProfileSchema[j].Name
+	})
+	return o
+}
+
+//loadOptions options of loaded users.
+//Users can only be shared by configs with same options.
+type loadOptions struct {
+	Example       string
+	Format        string
+	Directory     bool
+	ReadOnly      bool
+	StrictHash    bool
 	HashMode      string
+	Backups       int
+	SaveDelay     time.Duration
+	WatchInterval time.Duration
+	ProfileFields []string
+	ProfileSchema []ProfileField
 }
 
+//Load load users from source.
+//Users loaded from same absolute path are shared and reference counted.
+//Release should be called when loaded users no longer used.
+//ErrConflictingOptions will be returned if shared users loaded with different options.
 func (c *Config) Load() (*Users, error) {
 	locker.Lock()
-	locker.Unlock()
-	source, err := c.Source.Abs()
+	defer locker.Unlock()
+	u, err := c.load()
 	if err != nil {
 		return nil, err
 	}
-	err = source.VerifyWithExample(c.Example)
+	u.refs++
+	return u, nil
+}
+
+func (c *Config) load() (*Users, error) {
+	abs, err := c.Source.Abs()
 	if err != nil {
 		return nil, err
 	}
-	u, ok := registered[source]
+	source, err := NewSource(c.Format, string(abs))
+	if err != nil {
+		return nil, err
+	}
+	var example Source
+	if c.Example != "" {
+		example, err = NewSource(c.Format, string(c.Example))
+		if err != nil {
+			return nil, err
+		}
+	}
+	//Source should not be created from example in read only mode.
+	if c.Directory || c.ReadOnly {
+		example = nil
+	} else {
+		err = source.VerifyWithExample(example)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.StrictHash && c.HashMode != "" && !IsKnownHashMode(c.HashMode) {
+		return nil, fmt.Errorf("%w (%s)", ErrUnknownHashMode, c.HashMode)
+	}
+	options := c.options()
+	u, ok := registered[abs]
 	if ok && u != nil {
+		if !reflect.DeepEqual(u.options, options) {
+			return nil, fmt.Errorf("%w (%s)", ErrConflictingOptions, abs)
+		}
 		return u, nil
 	}
 	u = NewUsers()
-	u.Source = c.Source
-	data := NewData()
-	err = u.Source.Load(data)
+	u.options = options
+	u.Source = source
+	u.Example = example
+	u.Directory = c.Directory
+	u.ReadOnly = c.ReadOnly
+	u.StrictHash = c.StrictHash
+	if c.HashMode != "" {
+		u.HashMode = c.HashMode
+	}
+	u.Backups = c.Backups
+	u.saveDelay = options.SaveDelay
+	u.WatchInterval = options.WatchInterval
+	if len(c.ProfileSchema) != 0 {
+		u.ProfileSchema = NewProfileSchema(c.ProfileSchema...)
+		for _, v := range c.ProfileSchema {
+			err = v.Verify()
+			if err != nil {
+				return nil, err
+			}
+			u.ProfileFields[v.Name] = true
+		}
+	}
+	u.stat, err = u.statSource()
+	if err != nil {
+		return nil, err
+	}
+	data, err := u.loadData()
 	if err != nil {
 		return nil, err
 	}
@@ -73,13 +244,62 @@ func (c *Config) Load() (*Users, error) {
 	for k := range data.Users {
 		u.addUser(data.Users[k])
 	}
+	u.snapshot()
+	registered[abs] = u
 	return u, nil
 }
+
+//reloadPurger purge reloaded users in usersystem.
+//Purger is started and stopped with usersystem,
+//so stopped usersystem will not be called or kept by shared users.
+type reloadPurger struct {
+	users  *Users
+	system *usersystem.UserSystem
+	remove func()
+}
+
+//Start add reload callback to users.
+func (p *reloadPurger) Start() error {
+	p.remove = p.users.AddReloadCallback(p.purge)
+	return nil
+}
+
+//Stop remove reload callback from users.
+func (p *reloadPurger) Stop() error {
+	if p.remove != nil {
+		p.remove()
+		p.remove = nil
+	}
+	return nil
+}
+
+func (p *reloadPurger) purge(uids []string) {
+	for _, uid := range uids {
+		err := herbsystem.Catch(func() {
+			userpurge.MustExecPurge(p.system, uid)
+		})
+		if err != nil {
+			p.users.reloadError(err)
+		}
+	}
+}
+
+//Execute load users and serve them to usersystem.
+//Users are referenced by started services instead of load,
+//so they will be released when usersystem stopped.
+//Reloaded users will be purged in usersystem only while usersystem started if Watch is true.
 func (c *Config) Execute(s *usersystem.UserSystem) error {
-	u, err := c.Load()
+	locker.Lock()
+	u, err := c.load()
+	locker.Unlock()
 	if err != nil {
 		return err
 	}
+	if c.Watch {
+		p := &reloadPurger{users: u, system: s}
+		m := storemodule.New("tomluser.reloadpurger:"+u.Source.Path(), func() interface{} { return p })
+		storemodule.MustInstallTo(s, &m)
+	}
 	if c.ServeStatus {
 		ss := userstatus.MustGetModule(s)
 		if ss != nil {
@@ -104,7 +324,7 @@ func (c *Config) Execute(s *usersystem.UserSystem) error {
 			ur.Service = u
 		}
 	}
-	if c.ServeTerm {
+	if c.ServeTerm && !c.ReadOnly {
 		ut := userterm.MustGetModule(s)
 		if ut != nil {
 			ut.Service = u
@@ -116,6 +336,18 @@ func (c *Config) Execute(s *usersystem.UserSystem) error {
 			up.AppendService(u)
 		}
 	}
+	if c.ServeTOTP && !c.ReadOnly {
+		t := totp.MustGetModule(s)
+		if t != nil {
+			t.Store = u
+		}
+	}
+	if c.ServeRecoveryCodes && !c.ReadOnly {
+		rc := recoverycode.MustGetModule(s)
+		if rc != nil {
+			rc.Store = u
+		}
+	}
 	return nil
 }
 
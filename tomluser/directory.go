@@ -0,0 +1,207 @@
+package tomluser
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+//ErrDuplicateUID error raised when uid found in more than one file in directory mode.
+var ErrDuplicateUID = errors.New("tomluser:duplicate uid")
+
+//ErrDuplicateAccount error raised when account bound to more than one user in directory mode.
+var ErrDuplicateAccount = errors.New("tomluser:duplicate account")
+
+//ErrUIDMismatch error raised when uid in file not match file name in directory mode.
+var ErrUIDMismatch = errors.New("tomluser:uid not match file name")
+
+//ErrInvalidUID error raised when uid can not be used as file name in directory mode.
+var ErrInvalidUID = errors.New("tomluser:invalid uid for file name")
+
+//SourceExt return file extension of given source format.
+func SourceExt(s Source) string {
+	switch s.(type) {
+	case JSONSource:
+		return ".json"
+	case YAMLSource:
+		return ".yaml"
+	}
+	return ".toml"
+}
+
+func (u *Users) userFile(uid string) (string, error) {
+	if uid == "" || uid != filepath.Base(uid) || strings.HasPrefix(uid, ".") {
+		return "", fmt.Errorf("%w (%s)", ErrInvalidUID, uid)
+	}
+	return filepath.Join(u.Source.Path(), uid+SourceExt(u.Source)), nil
+}
+
+func (u *Users) directoryFiles() ([]string, error) {
+	files, err := ioutil.ReadDir(u.Source.Path())
+	if err != nil {
+		return nil, err
+	}
+	ext := SourceExt(u.Source)
+	var result []string
+	for _, v := range files {
+		name := v.Name()
+		if v.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ext {
+			continue
+		}
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+//VerifyData check if uids and accounts in data are unique.
+//Return ErrDuplicateUID or ErrDuplicateAccount if not.
+func VerifyData(data *Data) error {
+	uids := map[string]bool{}
+	accounts := map[string]string{}
+	for _, v := range data.Users {
+		if uids[v.UID] {
+			return fmt.Errorf("%w (%s)", ErrDuplicateUID, v.UID)
+		}
+		uids[v.UID] = true
+		for _, a := range v.Accounts {
+			key := a.Keyword + "\x00" + a.Account
+			if uid, ok := accounts[key]; ok {
+				return fmt.Errorf("%w (%s:%s used by %s and %s)", ErrDuplicateAccount, a.Keyword, a.Account, uid, v.UID)
+			}
+			accounts[key] = v.UID
+		}
+	}
+	return nil
+}
+
+func (u *Users) loadDirectory() (*Data, error) {
+	files, err := u.directoryFiles()
+	if err != nil {
+		return nil, err
+	}
+	data := NewData()
+	ext := SourceExt(u.Source)
+	for _, name := range files {
+		us := NewUser()
+		err = u.Source.WithPath(filepath.Join(u.Source.Path(), name)).Load(us)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, name)
+		}
+		uid := strings.TrimSuffix(name, ext)
+		if us.UID == "" {
+			us.UID = uid
+		}
+		if us.UID != uid {
+			return nil, fmt.Errorf("%w (%s in %s)", ErrUIDMismatch, us.UID, name)
+		}
+		data.Users = append(data.Users, us)
+	}
+	err = VerifyData(data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (u *Users) loadData() (*Data, error) {
+	var data *Data
+	var err error
+	if u.Directory {
+		data, err = u.loadDirectory()
+	} else {
+		data = NewData()
+		err = u.Source.Load(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range data.Users {
+		err = v.resolveSecrets()
+		if err != nil {
+			return nil, fmt.Errorf("%w (uid %s)", err, v.UID)
+		}
+		if u.ProfileSchema != nil {
+			err = u.ProfileSchema.validateStored(v.Profiles)
+			if err != nil {
+				return nil, fmt.Errorf("%w (uid %s)", err, v.UID)
+			}
+		}
+	}
+	return data, nil
+}
+
+func (u *Users) snapshot() {
+	if !u.Directory {
+		return
+	}
+	u.written = make(map[string]*User, len(u.uidmap))
+	for k := range u.uidmap {
+		u.written[k] = u.uidmap[k].Clone()
+	}
+}
+
+//saveDirectory write files of changed users and remove files of removed users.
+func (u *Users) saveDirectory() error {
+	for k := range u.uidmap {
+		current := u.uidmap[k].Clone()
+		if reflect.DeepEqual(u.written[k], current) {
+			continue
+		}
+		path, err := u.userFile(k)
+		if err != nil {
+			return err
+		}
+		err = WriteAtomic(u.Source.WithPath(path), u.uidmap[k].unresolved(), u.Backups)
+		if err != nil {
+			return err
+		}
+		u.written[k] = current
+	}
+	for k := range u.written {
+		if u.uidmap[k] != nil {
+			continue
+		}
+		path, err := u.userFile(k)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(u.written, k)
+	}
+	return nil
+}
+
+//statDirectory return latest modified time and total size of user files in directory.
+func (u *Users) statDirectory() (fileStat, error) {
+	files, err := u.directoryFiles()
+	if err != nil {
+		return fileStat{}, err
+	}
+	var result fileStat
+	result.count = len(files)
+	for _, name := range files {
+		stat, err := statSource(filepath.Join(u.Source.Path(), name))
+		if err != nil {
+			return fileStat{}, err
+		}
+		if stat.modTime.After(result.modTime) {
+			result.modTime = stat.modTime
+		}
+		result.size += stat.size
+	}
+	return result, nil
+}
+
+func (u *Users) statSource() (fileStat, error) {
+	if u.Directory {
+		return u.statDirectory()
+	}
+	return statSource(u.Source.Path())
+}
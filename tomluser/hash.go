@@ -2,19 +2,176 @@ package tomluser
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
+//ErrUnknownHashMode error raised when hash mode not registered in strict mode.
+var ErrUnknownHashMode = errors.New("tomluser:unknown hash mode")
+
+//ErrInvalidHash error raised when stored hash format invalid.
+var ErrInvalidHash = errors.New("tomluser:invalid hash")
+
+//Hasher password hasher interface
+type Hasher interface {
+	//Hash hash password with given salt.
+	Hash(password string, salt string) (string, error)
+	//Verify verify password with given hashed password and salt.
+	Verify(hashed string, password string, salt string) (bool, error)
+}
+
+type digestHasher func(data []byte) []byte
+
+func (h digestHasher) Hash(password string, salt string) (string, error) {
+	return hex.EncodeToString(h([]byte(password + salt))), nil
+}
+
+func (h digestHasher) Verify(hashed string, password string, salt string) (bool, error) {
+	result, err := h.Hash(password, salt)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(result), []byte(hashed)) == 1, nil
+}
+
+//BcryptHasher bcrypt password hasher.
+//Salt is generated by bcrypt and stored in hashed password.
+type BcryptHasher struct {
+	//Cost bcrypt cost.
+	Cost int
+}
+
+//Hash hash password.
+func (h *BcryptHasher) Hash(password string, salt string) (string, error) {
+	data, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//Verify verify password with given hashed password.
+func (h *BcryptHasher) Verify(hashed string, password string, salt string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//Argon2idHasher argon2id password hasher.
+//Hashed password is stored in PHC string format with its own random salt.
+type Argon2idHasher struct {
+	//Time argon2 time cost.
+	Time uint32
+	//Memory argon2 memory cost in KiB.
+	Memory uint32
+	//Threads argon2 parallelism.
+	Threads uint8
+	//KeyLength hash length in bytes.
+	KeyLength uint32
+	//SaltLength random salt length in bytes.
+	SaltLength int
+}
+
+//Hash hash password.
+func (h *Argon2idHasher) Hash(password string, salt string) (string, error) {
+	s := make([]byte, h.SaltLength)
+	_, err := rand.Read(s)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), s, h.Time, h.Memory, h.Threads, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(s),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+//Verify verify password with given hashed password.
+func (h *Argon2idHasher) Verify(hashed string, password string, salt string) (bool, error) {
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrInvalidHash
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return false, ErrInvalidHash
+	}
+	var memory, time uint32
+	var threads uint8
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	s, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	result := argon2.IDKey([]byte(password), s, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(result, key) == 1, nil
+}
+
+//Hashers registered password hashers by hash mode.
+var Hashers = map[string]Hasher{
+	"md5": digestHasher(func(data []byte) []byte {
+		sum := md5.Sum(data)
+		return sum[:]
+	}),
+	"sha256": digestHasher(func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}),
+	"bcrypt": &BcryptHasher{Cost: bcrypt.DefaultCost},
+	"argon2id": &Argon2idHasher{
+		Time:       1,
+		Memory:     64 * 1024,
+		Threads:    4,
+		KeyLength:  32,
+		SaltLength: 16,
+	},
+}
+
+//IsKnownHashMode check if hash mode registered in Hashers.
+func IsKnownHashMode(mode string) bool {
+	_, ok := Hashers[mode]
+	return ok
+}
+
+//Hash hash password of user with given mode.
+//Password will be returned as plaintext if hash mode unknown.
+//Use HashStrict to avoid storing plaintext password.
 func Hash(mode string, password string, user *User) (string, error) {
-	switch mode {
-	case "md5":
-		data := md5.Sum([]byte(password + user.Salt))
-		return hex.EncodeToString(data[:]), nil
+	h, ok := Hashers[mode]
+	if !ok {
+		return password, nil
+	}
+	return h.Hash(password, user.Salt)
+}
 
-	case "sha256":
-		data := sha256.Sum256([]byte(password + user.Salt))
-		return hex.EncodeToString(data[:]), nil
+//HashStrict hash password of user with given mode.
+//ErrUnknownHashMode will be returned if hash mode unknown.
+func HashStrict(mode string, password string, user *User) (string, error) {
+	if !IsKnownHashMode(mode) {
+		return "", fmt.Errorf("%w (%s)", ErrUnknownHashMode, mode)
 	}
-	return password, nil
+	return Hash(mode, password, user)
 }
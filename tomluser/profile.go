@@ -0,0 +1,142 @@
+package tomluser
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/herb-go/user/profile"
+)
+
+//Profile field types
+const (
+	ProfileTypeString = "string"
+	ProfileTypeEmail  = "email"
+	ProfileTypeURL    = "url"
+	ProfileTypeInt    = "int"
+)
+
+//ProfileError error raised when profile not match schema.
+type ProfileError struct {
+	//Field profile field name.
+	Field string
+	//Reason why profile not match schema.
+	Reason string
+}
+
+//Error return error message.
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("tomluser:profile field %s %s", e.Field, e.Reason)
+}
+
+//ProfileField profile field schema
+type ProfileField struct {
+	//Name field name.
+	Name string
+	//Type field type,"string","email","url" or "int".
+	//Default value is "string".
+	Type string
+	//Required whether field must have value.
+	Required bool
+	//Multiple whether field can have more than one value.
+	Multiple bool
+	//MaxLength max value length in runes.
+	//Zero means no limit.
+	MaxLength int
+}
+
+//Verify verify if field schema is valid.
+//Return *ProfileError if field type unknown.
+func (f *ProfileField) Verify() error {
+	switch f.Type {
+	case "", ProfileTypeString, ProfileTypeEmail, ProfileTypeURL, ProfileTypeInt:
+		return nil
+	}
+	return &ProfileError{Field: f.Name, Reason: fmt.Sprintf("has unknown type %s", f.Type)}
+}
+
+func (f *ProfileField) validateValue(value string) error {
+	if f.MaxLength > 0 && utf8.RuneCountInString(value) > f.MaxLength {
+		return &ProfileError{Field: f.Name, Reason: fmt.Sprintf("longer than %d characters", f.MaxLength)}
+	}
+	switch f.Type {
+	case "", ProfileTypeString:
+		return nil
+	case ProfileTypeEmail:
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return &ProfileError{Field: f.Name, Reason: "is not a valid email"}
+		}
+		return nil
+	case ProfileTypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return &ProfileError{Field: f.Name, Reason: "is not a valid url"}
+		}
+		return nil
+	case ProfileTypeInt:
+		_, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return &ProfileError{Field: f.Name, Reason: "is not a valid int"}
+		}
+		return nil
+	}
+	return &ProfileError{Field: f.Name, Reason: fmt.Sprintf("has unknown type %s", f.Type)}
+}
+
+//ProfileSchema profile field schemas by field name
+type ProfileSchema map[string]*ProfileField
+
+//NewProfileSchema create profile schema with given fields.
+func NewProfileSchema(fields ...*ProfileField) ProfileSchema {
+	s := ProfileSchema{}
+	for _, v := range fields {
+		s[v.Name] = v
+	}
+	return s
+}
+
+//Validate validate profile with schema.
+//Nil profile will be validated as empty profile.
+//Return *ProfileError if profile not match schema.
+func (s ProfileSchema) Validate(p *profile.Profile) error {
+	return s.validate(p, true)
+}
+
+//validateStored validate profile loaded from source.
+//Required fields are not checked for users whose profile never set,
+//so users created without profile can be loaded again.
+func (s ProfileSchema) validateStored(p *profile.Profile) error {
+	return s.validate(p, p != nil && len(p.Data()) != 0)
+}
+
+func (s ProfileSchema) validate(p *profile.Profile, required bool) error {
+	counts := map[string]int{}
+	if p != nil {
+		for _, v := range p.Data() {
+			f := s[v.Name]
+			if f == nil {
+				return &ProfileError{Field: v.Name, Reason: "is not defined in schema"}
+			}
+			counts[v.Name]++
+			if counts[v.Name] > 1 && !f.Multiple {
+				return &ProfileError{Field: v.Name, Reason: "can not have multiple values"}
+			}
+			err := f.validateValue(v.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !required {
+		return nil
+	}
+	for name, f := range s {
+		if f.Required && counts[name] == 0 {
+			return &ProfileError{Field: name, Reason: "is required"}
+		}
+	}
+	return nil
+}
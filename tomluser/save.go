@@ -0,0 +1,178 @@
+package tomluser
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//syncDir sync directory entries after renaming so the rename survives a crash.
+//Sync is best effort: data is already saved when called,
+//and directories can not be synced on some platforms like windows.
+func syncDir(dir string) {
+	syncFile(dir)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+//BackupPath return path of backup file of given source path with given index.
+func BackupPath(path string, index int) string {
+	return path + "." + strconv.Itoa(index) + ".bak"
+}
+
+func rotateBackups(path string, backups int) error {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i := backups - 1; i > 0; i-- {
+		err = os.Rename(BackupPath(path, i), BackupPath(path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return copyFile(path, BackupPath(path, 1))
+}
+
+//WriteAtomic save data to source atomically.
+//Data is written to temp file in same folder,synced and renamed to source,
+//so source file will not be corrupted if process crashed when saving.
+//Given number of rotating backups of previous source file will be kept.
+func WriteAtomic(source Source, data interface{}, backups int) error {
+	path := source.Path()
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmppath := tmp.Name()
+	err = tmp.Close()
+	if err != nil {
+		os.Remove(tmppath)
+		return err
+	}
+	defer os.Remove(tmppath)
+	if info, err := os.Stat(path); err == nil {
+		err = os.Chmod(tmppath, info.Mode())
+		if err != nil {
+			return err
+		}
+	}
+	err = source.WithPath(tmppath).Save(data)
+	if err != nil {
+		return err
+	}
+	err = syncFile(tmppath)
+	if err != nil {
+		return err
+	}
+	if backups > 0 {
+		err = rotateBackups(path, backups)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.Rename(tmppath, path)
+	if err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+func (u *Users) write() error {
+	var err error
+	if u.Directory {
+		err = u.saveDirectory()
+	} else {
+		err = WriteAtomic(u.Source, u.unresolvedData(), u.Backups)
+	}
+	if err != nil {
+		return err
+	}
+	stat, err := u.statSource()
+	if err == nil {
+		u.stat = stat
+	}
+	u.dirty = false
+	return nil
+}
+
+func (u *Users) delayedSave() {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	u.saveTimer = nil
+	if !u.dirty {
+		return
+	}
+	err := u.write()
+	if err != nil && u.OnSaveError != nil {
+		u.OnSaveError(err)
+	}
+}
+
+//SaveNow save pending changes immediately in batched save mode.
+//Return any error if raised.
+func (u *Users) SaveNow() error {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	if u.saveTimer != nil {
+		u.saveTimer.Stop()
+		u.saveTimer = nil
+	}
+	if !u.dirty {
+		return nil
+	}
+	return u.write()
+}
+
+//SetSaveDelay set delay of batched save mode.
+//Changes in delay will be saved together.
+//Changes will be saved immediately if delay is not positive.
+func (u *Users) SetSaveDelay(delay time.Duration) {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	u.saveDelay = delay
+}
@@ -0,0 +1,122 @@
+package tomluser
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//ErrUnresolvedSecret error raised when secret reference can not be resolved.
+var ErrUnresolvedSecret = errors.New("tomluser:secret reference can not be resolved")
+
+//SecretResolver resolve secret by reference name.
+type SecretResolver func(name string) (string, error)
+
+//SecretResolvers registered secret resolvers by reference scheme.
+//Value in "scheme:name" format with registered scheme,like "env:NAME" or "file:/run/secrets/x",
+//will be resolved at load time.
+var SecretResolvers = map[string]SecretResolver{
+	"env": func(name string) (string, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w (environment variable %s not set)", ErrUnresolvedSecret, name)
+		}
+		return v, nil
+	},
+	"file": func(name string) (string, error) {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("%w (%s)", ErrUnresolvedSecret, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	},
+}
+
+//IsSecretReference check if value is a reference with registered scheme.
+func IsSecretReference(v string) bool {
+	i := strings.Index(v, ":")
+	if i <= 0 {
+		return false
+	}
+	_, ok := SecretResolvers[v[:i]]
+	return ok
+}
+
+//ResolveSecret resolve value if it is secret reference.
+//Value will be returned directly if not a reference.
+func ResolveSecret(v string) (string, error) {
+	if !IsSecretReference(v) {
+		return v, nil
+	}
+	i := strings.Index(v, ":")
+	return SecretResolvers[v[:i]](v[i+1:])
+}
+
+type secretRef struct {
+	ref      string
+	resolved string
+}
+
+func resolveField(field *string, name string, refs map[string]*secretRef) error {
+	if !IsSecretReference(*field) {
+		return nil
+	}
+	v, err := ResolveSecret(*field)
+	if err != nil {
+		return fmt.Errorf("%w (field %s)", err, name)
+	}
+	refs[name] = &secretRef{ref: *field, resolved: v}
+	*field = v
+	return nil
+}
+
+func restoreField(field *string, name string, refs map[string]*secretRef) {
+	r := refs[name]
+	if r != nil && *field == r.resolved {
+		*field = r.ref
+	}
+}
+
+//resolveSecrets resolve secret references in password,salt and totp secret.
+//Plaintext password is never resolved,so plaintext like "env:NAME" is kept as is.
+//References are kept so that they can be written back when saving.
+func (u *User) resolveSecrets() error {
+	var err error
+	refs := map[string]*secretRef{}
+	if !u.IsPlaintext() {
+		err = resolveField(&u.Password, "Password", refs)
+		if err != nil {
+			return err
+		}
+	}
+	err = resolveField(&u.Salt, "Salt", refs)
+	if err != nil {
+		return err
+	}
+	if u.TOTP != nil {
+		err = resolveField(&u.TOTP.Secret, "TOTP.Secret", refs)
+		if err != nil {
+			return err
+		}
+	}
+	if len(refs) != 0 {
+		u.secrets = refs
+	}
+	return nil
+}
+
+//unresolved return copy of user with unchanged secret fields replaced by references.
+func (u *User) unresolved() *User {
+	result := u.Clone()
+	if u.secrets == nil {
+		return result
+	}
+	restoreField(&result.Password, "Password", u.secrets)
+	restoreField(&result.Salt, "Salt", u.secrets)
+	if result.TOTP != nil {
+		restoreField(&result.TOTP.Secret, "TOTP.Secret", u.secrets)
+	}
+	return result
+}
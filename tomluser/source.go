@@ -0,0 +1,227 @@
+package tomluser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/herb-go/providers/herb/statictoml"
+	"gopkg.in/yaml.v2"
+)
+
+//ErrUnknownSourceFormat error raised when source format not supported.
+var ErrUnknownSourceFormat = errors.New("tomluser:unknown source format")
+
+//Source formats
+const (
+	FormatTOML = "toml"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+//Source file source which users data loaded from and saved to.
+type Source interface {
+	//Path return source file path.
+	Path() string
+	//Load load data from source.
+	Load(v interface{}) error
+	//Save save data to source.
+	Save(v interface{}) error
+	//VerifyWithExample verify source with given example source.
+	VerifyWithExample(example Source) error
+	//WithPath create new source in same format with given path.
+	WithPath(path string) Source
+}
+
+//TOMLSource toml file source
+type TOMLSource statictoml.Source
+
+//Path return source file path.
+func (s TOMLSource) Path() string {
+	return string(s)
+}
+
+//Load load data from source.
+func (s TOMLSource) Load(v interface{}) error {
+	return statictoml.Source(s).Load(v)
+}
+
+//Save save data to source.
+func (s TOMLSource) Save(v interface{}) error {
+	return statictoml.Source(s).Save(v)
+}
+
+//VerifyWithExample verify source with given example source.
+func (s TOMLSource) VerifyWithExample(example Source) error {
+	if example == nil {
+		return statictoml.Source(s).VerifyWithExample("")
+	}
+	return statictoml.Source(s).VerifyWithExample(statictoml.Source(example.Path()))
+}
+
+//WithPath create new toml source with given path.
+func (s TOMLSource) WithPath(path string) Source {
+	return TOMLSource(path)
+}
+
+//verifyFileWithExample create source file by copying example if source file not exists.
+func verifyFileWithExample(path string, example Source) error {
+	_, err := os.Stat(path)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) || example == nil || example.Path() == "" {
+		return err
+	}
+	return copyFile(example.Path(), path)
+}
+
+//JSONSource json file source
+type JSONSource string
+
+//Path return source file path.
+func (s JSONSource) Path() string {
+	return string(s)
+}
+
+//Load load data from source.
+//Empty file will be treated as empty data.
+func (s JSONSource) Load(v interface{}) error {
+	data, err := ioutil.ReadFile(string(s))
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+//Save save data to source.
+func (s JSONSource) Save(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(string(s), data, 0600)
+}
+
+//VerifyWithExample verify source with given example source.
+//Source file will be created from example if not exists.
+func (s JSONSource) VerifyWithExample(example Source) error {
+	return verifyFileWithExample(string(s), example)
+}
+
+//WithPath create new json source with given path.
+func (s JSONSource) WithPath(path string) Source {
+	return JSONSource(path)
+}
+
+//YAMLSource yaml file source
+//Data will be converted through json,so yaml keys are same as json and toml field names like "UID" and "Password".
+type YAMLSource string
+
+//Path return source file path.
+func (s YAMLSource) Path() string {
+	return string(s)
+}
+
+//Load load data from source.
+func (s YAMLSource) Load(v interface{}) error {
+	data, err := ioutil.ReadFile(string(s))
+	if err != nil {
+		return err
+	}
+	var raw interface{}
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(yamlToJSONValue(raw))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//Save save data to source.
+func (s YAMLSource) Save(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	//Json is valid yaml,map slice keeps field order.
+	var raw yaml.MapSlice
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	data, err = yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(string(s), data, 0600)
+}
+
+//yamlToJSONValue convert maps decoded by yaml to maps with string keys which can be encoded by json.
+func yamlToJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			result[fmt.Sprint(key)] = yamlToJSONValue(value)
+		}
+		return result
+	case []interface{}:
+		for k := range v {
+			v[k] = yamlToJSONValue(v[k])
+		}
+		return v
+	}
+	return v
+}
+
+//VerifyWithExample verify source with given example source.
+//Source file will be created from example if not exists.
+func (s YAMLSource) VerifyWithExample(example Source) error {
+	return verifyFileWithExample(string(s), example)
+}
+
+//WithPath create new yaml source with given path.
+func (s YAMLSource) WithPath(path string) Source {
+	return YAMLSource(path)
+}
+
+//DetectFormat detect source format by file extension.
+//FormatTOML will be returned if extension unknown.
+func DetectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatTOML
+}
+
+//NewSource create new source with given format and path.
+//Format will be detected by file extension if empty.
+//Return source and any error if raised.
+func NewSource(format string, path string) (Source, error) {
+	if format == "" {
+		format = DetectFormat(path)
+	}
+	switch format {
+	case FormatTOML:
+		return TOMLSource(path), nil
+	case FormatJSON:
+		return JSONSource(path), nil
+	case FormatYAML:
+		return YAMLSource(path), nil
+	}
+	return nil, fmt.Errorf("%w (%s)", ErrUnknownSourceFormat, format)
+}
@@ -1,8 +1,8 @@
 package tomluser
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"crypto/subtle"
 
 	"github.com/herb-go/user/status"
 
@@ -10,6 +10,7 @@ import (
 
 	"github.com/herb-go/herbsecurity/authorize/role"
 	"github.com/herb-go/user"
+	"github.com/herb-go/usersystem-drivers/totp"
 )
 
 var defaultUsersHashMode = "sha256"
@@ -17,23 +18,45 @@ var saltlength = 8
 var saltchars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 func getSalt(length int) string {
-	result := ""
-	for i := 0; i < length; i++ {
-		result = result + string(saltchars[rand.Intn(len(saltchars))])
+	result := make([]byte, 0, length)
+	//Bytes out of range are dropped to avoid modulo bias.
+	max := byte(256 / len(saltchars) * len(saltchars))
+	data := make([]byte, length)
+	for len(result) < length {
+		_, err := rand.Read(data)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range data {
+			if v < max && len(result) < length {
+				result = append(result, saltchars[int(v)%len(saltchars)])
+			}
+		}
 	}
-	return result
+	return string(result)
 }
 
 type User struct {
-	UID      string
+	UID string
+	//Password hashed password,or plaintext password if HashMode is not a known hash mode.
+	//Hashed password can be a secret reference like "env:NAME" or "file:/run/secrets/x",
+	//which will be resolved at load time and kept when saving.
+	//Plaintext password is never resolved.
 	Password string
 	HashMode string
+	//Salt password salt.
+	//Salt can be a secret reference like "env:NAME" or "file:/run/secrets/x".
 	Salt     string
 	Accounts []*user.Account
 	Banned   bool
 	Roles    *role.Roles
 	Term     string
 	Profiles *profile.Profile
+	//TOTP totp secret.
+	//Secret field can be a secret reference like "env:NAME" or "file:/run/secrets/x".
+	TOTP          *totp.Secret
+	RecoveryCodes []string
+	secrets       map[string]*secretRef
 }
 
 func (u *User) Status() status.Status {
@@ -45,16 +68,25 @@ func (u *User) Status() status.Status {
 func (u *User) Clone() *User {
 	newuser := NewUser()
 	newuser.UID = u.UID
+	newuser.Password = u.Password
 	newuser.HashMode = u.HashMode
 	newuser.Salt = u.Salt
 	newuser.Accounts = make([]*user.Account, len(u.Accounts))
 	copy(newuser.Accounts, u.Accounts)
 	newuser.Banned = u.Banned
-	roles := make(role.Roles, len(*u.Roles))
-	newuser.Roles = &roles
-	copy(*newuser.Roles, *u.Roles)
+	if u.Roles != nil {
+		roles := make(role.Roles, len(*u.Roles))
+		newuser.Roles = &roles
+		copy(*newuser.Roles, *u.Roles)
+	}
 	newuser.Term = u.Term
 	newuser.Profiles = u.Profiles.Clone()
+	if u.TOTP != nil {
+		secret := *u.TOTP
+		newuser.TOTP = &secret
+	}
+	newuser.RecoveryCodes = make([]string, len(u.RecoveryCodes))
+	copy(newuser.RecoveryCodes, u.RecoveryCodes)
 	return newuser
 }
 func (u *User) SetTo(newuser *User) {
@@ -65,23 +97,42 @@ func (u *User) SetTo(newuser *User) {
 	newuser.Accounts = u.Accounts
 	newuser.Banned = u.Banned
 	newuser.Roles = u.Roles
+	newuser.Term = u.Term
+	newuser.Profiles = u.Profiles
+	newuser.TOTP = u.TOTP
+	newuser.RecoveryCodes = u.RecoveryCodes
 }
 
 func (u *User) VerifyPassword(password string) (bool, error) {
 	if u.Password == "" {
 		return false, nil
 	}
-	hashed, err := Hash(u.HashMode, password, u)
-	if err != nil {
-		return false, err
+	h, ok := Hashers[u.HashMode]
+	if !ok {
+		return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1, nil
 	}
-	return hashed == u.Password, nil
+	return h.Verify(u.Password, password, u.Salt)
+}
+
+//IsPlaintext check if user password stored in plaintext.
+func (u *User) IsPlaintext() bool {
+	return u.Password != "" && !IsKnownHashMode(u.HashMode)
 }
 func (u *User) UpdatePassword(hashmode string, password string) error {
+	return u.updatePassword(Hash, hashmode, password)
+}
+
+//UpdatePasswordStrict update user password.
+//ErrUnknownHashMode will be returned if hash mode unknown.
+func (u *User) UpdatePasswordStrict(hashmode string, password string) error {
+	return u.updatePassword(HashStrict, hashmode, password)
+}
+
+func (u *User) updatePassword(hash func(string, string, *User) (string, error), hashmode string, password string) error {
 	newuser := u.Clone()
 	newuser.HashMode = hashmode
 	newuser.Salt = getSalt(saltlength)
-	hashed, err := Hash(hashmode, password, newuser)
+	hashed, err := hash(hashmode, password, newuser)
 	if err != nil {
 		return err
 	}
@@ -95,7 +146,3 @@ func NewUser() *User {
 		Profiles: profile.NewProfile(),
 	}
 }
-
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
@@ -1,21 +1,25 @@
 package tomluser
 
 import (
+	"errors"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/herb-go/herbsecurity/authorize/role"
 	"github.com/herb-go/uniqueid"
 
-	"github.com/herb-go/providers/herb/statictoml"
-
 	"github.com/herb-go/user"
 	"github.com/herb-go/user/profile"
 	"github.com/herb-go/user/status"
+	"github.com/herb-go/usersystem-drivers/totp"
 )
 
+//ErrReadOnly error raised when mutating users in read only mode.
+var ErrReadOnly = errors.New("tomluser:users are read only")
+
 type Users struct {
-	Source     statictoml.Source
+	Source     Source
 	locker     sync.RWMutex
 	uidmap     map[string]*User
 	accountmap map[string][]*User
@@ -23,6 +27,38 @@ type Users struct {
 	HashMode   string
 	status.Service
 	ProfileFields map[string]bool
+	//ProfileSchema profile field schemas.
+	//Profile will be validated with schema when updating if not nil,
+	//otherwise fields not in ProfileFields will be dropped.
+	ProfileSchema ProfileSchema
+	//StrictHash whether raise ErrUnknownHashMode instead of storing plaintext password when hash mode unknown.
+	StrictHash bool
+	//ReadOnly whether all mutations fail with ErrReadOnly.
+	ReadOnly bool
+	//Directory whether source is a directory contains one file per user named by uid.
+	Directory bool
+	//Example example source used to verify source when reloading.
+	Example Source
+	//WatchInterval interval to check source file when started.
+	//Source file will not be watched if zero.
+	WatchInterval time.Duration
+	//OnReloadError callback called with error raised when reloading or purging reloaded users in watching mode.
+	//Errors will be logged by standard logger if nil.
+	OnReloadError func(err error)
+	//Backups number of rotating backups kept when saving.
+	Backups int
+	//OnSaveError callback called with error raised when saving in batched save mode.
+	OnSaveError func(err error)
+	stat        fileStat
+	watchLocker sync.Mutex
+	stopWatch   chan struct{}
+	written     map[string]*User
+	refs        int
+	options     *loadOptions
+	callbacks   []*reloadCallback
+	saveDelay   time.Duration
+	saveTimer   *time.Timer
+	dirty       bool
 }
 
 func (u *Users) MustGetProfile(id string) *profile.Profile {
@@ -35,6 +71,7 @@ func (u *Users) MustGetProfile(id string) *profile.Profile {
 	return userdata.Profiles.Clone()
 }
 func (u *Users) MustUpdateProfile(id string, p *profile.Profile) {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	userdata := u.uidmap[id]
@@ -42,10 +79,20 @@ func (u *Users) MustUpdateProfile(id string, p *profile.Profile) {
 		panic(user.ErrUserNotExists)
 	}
 	prf := profile.NewProfile()
-	for _, v := range p.Data() {
-		if u.ProfileFields[v.Name] {
+	if u.ProfileSchema != nil {
+		err := u.ProfileSchema.Validate(p)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range p.Data() {
 			prf.WithFields(v)
 		}
+	} else {
+		for _, v := range p.Data() {
+			if u.ProfileFields[v.Name] {
+				prf.WithFields(v)
+			}
+		}
 	}
 	userdata.Profiles = prf
 	u.mustSave()
@@ -59,6 +106,17 @@ func (u *Users) GetAllUsers() *Data {
 	}
 	return data
 }
+
+//unresolvedData return data to save with secret references kept.
+func (u *Users) unresolvedData() *Data {
+	data := NewData()
+	data.Users = make([]*User, 0, len(u.uidmap))
+	for k := range u.uidmap {
+		data.Users = append(data.Users, u.uidmap[k].unresolved())
+	}
+	return data
+}
+
 func (u *Users) mustSave() {
 	err := u.save()
 	if err != nil {
@@ -67,7 +125,14 @@ func (u *Users) mustSave() {
 }
 
 func (u *Users) save() error {
-	return u.Source.Save(u.GetAllUsers())
+	if u.saveDelay <= 0 {
+		return u.write()
+	}
+	u.dirty = true
+	if u.saveTimer == nil {
+		u.saveTimer = time.AfterFunc(u.saveDelay, u.delayedSave)
+	}
+	return nil
 }
 func (u *Users) MustLoadStatus(id string) (status.Status, bool) {
 	u.locker.RLock()
@@ -86,6 +151,7 @@ func (u *Users) MustLoadStatus(id string) (status.Status, bool) {
 
 }
 func (u *Users) MustUpdateStatus(uid string, st status.Status) {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
 
@@ -101,6 +167,14 @@ func (u *Users) MustUpdateStatus(uid string, st status.Status) {
 
 }
 func (u *Users) MustCreateStatus(uid string) {
+	u.mustWritable()
+	//Uid should be validated before user added,otherwise invalid user will be kept in memory when saving failed.
+	if u.Directory {
+		_, err := u.userFile(uid)
+		if err != nil {
+			panic(err)
+		}
+	}
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	if u.uidmap[uid] != nil {
@@ -112,6 +186,7 @@ func (u *Users) MustCreateStatus(uid string) {
 	u.mustSave()
 }
 func (u *Users) MustRemoveStatus(uid string) {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	if u.uidmap[uid] == nil {
@@ -178,42 +253,174 @@ func (u *Users) MustVerifyPassword(uid string, password string) bool {
 }
 
 //PasswordChangeable return password changeable
+//Return false in read only mode.
 func (u *Users) PasswordChangeable() bool {
-	return true
+	return !u.ReadOnly
+}
+
+func (u *Users) mustWritable() {
+	if u.ReadOnly {
+		panic(ErrReadOnly)
+	}
 }
 
 //UpdatePassword update user password
 func (u *Users) MustUpdatePassword(uid string, password string) {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	us := u.uidmap[uid]
 	if us == nil {
 		panic(user.ErrUserNotExists)
 	}
-	err := us.UpdatePassword(u.HashMode, password)
+	var err error
+	if u.StrictHash {
+		err = us.UpdatePasswordStrict(u.HashMode, password)
+	} else {
+		err = us.UpdatePassword(u.HashMode, password)
+	}
 	if err != nil {
 		panic(err)
 	}
 	u.mustSave()
 }
-func (u *Users) MustRoles(uid string) *role.Roles {
+
+//PlaintextUsers return uids of users whose password stored in plaintext.
+func (u *Users) PlaintextUsers() []string {
+	u.locker.RLock()
+	defer u.locker.RUnlock()
+	var result []string
+	for k := range u.uidmap {
+		if u.uidmap[k].IsPlaintext() {
+			result = append(result, k)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+//MustUpgradePlaintext hash all plaintext passwords with users hash mode and save.
+//ErrUnknownHashMode will be raised if users hash mode unknown.
+//Return upgraded users count.
+func (u *Users) MustUpgradePlaintext() int {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
+	var count int
+	for k := range u.uidmap {
+		us := u.uidmap[k]
+		if !us.IsPlaintext() {
+			continue
+		}
+		err := us.UpdatePasswordStrict(u.HashMode, us.Password)
+		if err != nil {
+			panic(err)
+		}
+		count++
+	}
+	if count != 0 {
+		u.mustSave()
+	}
+	return count
+}
+func (u *Users) MustRoles(uid string) *role.Roles {
+	u.locker.RLock()
+	defer u.locker.RUnlock()
 	us := u.uidmap[uid]
 	if us == nil {
 		panic(user.ErrUserNotExists)
 	}
+	if us.Roles == nil {
+		return &role.Roles{}
+	}
 	return us.Roles.Clone()
 }
+
+//SetRoles replace roles of given uid and save.
+//Return any error if raised.
 func (u *Users) SetRoles(uid string, r *role.Roles) error {
+	if u.ReadOnly {
+		return ErrReadOnly
+	}
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	us := u.uidmap[uid]
 	if us == nil {
 		return user.ErrUserNotExists
 	}
-	us.Roles = r
-	return nil
+	if r == nil {
+		r = &role.Roles{}
+	}
+	us.Roles = r.Clone()
+	return u.save()
+}
+
+//MustReplaceRoles replace roles of given uid.
+func (u *Users) MustReplaceRoles(uid string, r *role.Roles) {
+	err := u.SetRoles(uid, r)
+	if err != nil {
+		panic(err)
+	}
+}
+
+//MustGrantRoles grant roles to given uid.
+//Granted role with same name will be replaced.
+func (u *Users) MustGrantRoles(uid string, roles ...*role.Role) {
+	u.mustWritable()
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	result := role.Roles{}
+	if us.Roles != nil {
+		result = append(result, *us.Roles...)
+	}
+NEXT:
+	for _, r := range roles {
+		for k := range result {
+			if result[k].Name == r.Name {
+				result[k] = r
+				continue NEXT
+			}
+		}
+		result = append(result, r)
+	}
+	us.Roles = &result
+	u.mustSave()
+}
+
+//MustRevokeRoles revoke roles with given names from given uid.
+//Return revoked roles count.
+func (u *Users) MustRevokeRoles(uid string, names ...string) int {
+	u.mustWritable()
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	if us.Roles == nil {
+		return 0
+	}
+	revoking := map[string]bool{}
+	for _, v := range names {
+		revoking[v] = true
+	}
+	result := role.Roles{}
+	for _, v := range *us.Roles {
+		if !revoking[v.Name] {
+			result = append(result, v)
+		}
+	}
+	revoked := len(*us.Roles) - len(result)
+	if revoked == 0 {
+		return 0
+	}
+	us.Roles = &result
+	u.mustSave()
+	return revoked
 }
 func (u *Users) MustAccounts(uid string) *user.Accounts {
 	u.locker.RLock()
@@ -253,6 +460,7 @@ func (u *Users) MustAccountToUID(account *user.Account) (uid string) {
 //BindAccount bind account to user.
 //If account exists,user.ErrAccountBindingExists should be rasied.
 func (u *Users) MustBindAccount(uid string, account *user.Account) {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	accountuser := u.uidmap[uid]
@@ -274,6 +482,7 @@ func (u *Users) MustBindAccount(uid string, account *user.Account) {
 //UnbindAccount unbind account from user.
 //If account not exists,user.ErrAccountUnbindingNotExists should be rasied.
 func (u *Users) MustUnbindAccount(uid string, account *user.Account) {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	accountuser := u.uidmap[uid]
@@ -303,8 +512,8 @@ func (u *Users) MustUnbindAccount(uid string, account *user.Account) {
 }
 
 func (u *Users) MustCurrentTerm(uid string) string {
-	u.locker.Lock()
-	defer u.locker.Unlock()
+	u.locker.RLock()
+	defer u.locker.RUnlock()
 	us := u.uidmap[uid]
 	if us == nil {
 		panic(user.ErrUserNotExists)
@@ -313,6 +522,7 @@ func (u *Users) MustCurrentTerm(uid string) string {
 
 }
 func (u *Users) MustStartNewTerm(uid string) string {
+	u.mustWritable()
 	u.locker.Lock()
 	defer u.locker.Unlock()
 	us := u.uidmap[uid]
@@ -324,23 +534,29 @@ func (u *Users) MustStartNewTerm(uid string) string {
 		panic(err)
 	}
 	us.Term = term
+	u.mustSave()
 	return term
 }
 
 func (u *Users) addUser(user *User) {
 	u.uidmap[user.UID] = user
 	for _, a := range user.Accounts {
-		u.accountmap[a.Account] = append(u.accountmap[a.Keyword], user)
+		u.accountmap[a.Account] = append(u.accountmap[a.Account], user)
 	}
 }
 
 func (u *Users) removeUser(uid string) {
 	user := u.uidmap[uid]
+	if user == nil {
+		return
+	}
 	delete(u.uidmap, uid)
 	for _, a := range user.Accounts {
-		accounts := make([]*User, 0, len(u.accountmap[a.Account])-1)
+		accounts := []*User{}
 		for _, v := range u.accountmap[a.Account] {
-			accounts = append(accounts, v)
+			if v.UID != uid {
+				accounts = append(accounts, v)
+			}
 		}
 		u.accountmap[a.Account] = accounts
 	}
@@ -349,11 +565,46 @@ func (u *Users) removeUser(uid string) {
 func (u *Users) Purge(uid string) error {
 	return nil
 }
+
+//Start start users.
+//Started users are referenced until stopped,
+//source file will be watched when first started if WatchInterval is positive.
 func (u *Users) Start() error {
+	locker.Lock()
+	defer locker.Unlock()
+	u.refs++
+	if u.WatchInterval > 0 && !u.watching() {
+		u.Watch(u.WatchInterval)
+	}
 	return nil
 }
+
+//Stop stop users.
+//Users will be stopped and removed from registry when not referenced by loads or started services.
 func (u *Users) Stop() error {
-	return nil
+	locker.Lock()
+	defer locker.Unlock()
+	return u.release()
+}
+
+func (u *Users) release() error {
+	if u.refs > 0 {
+		u.refs--
+	}
+	if u.refs > 0 {
+		return nil
+	}
+	for k := range registered {
+		if registered[k] == u {
+			delete(registered, k)
+		}
+	}
+	return u.stop()
+}
+
+func (u *Users) stop() error {
+	u.Unwatch()
+	return u.SaveNow()
 }
 
 func NewUsers() *Users {
@@ -366,3 +617,111 @@ func NewUsers() *Users {
 		ProfileFields: map[string]bool{},
 	}
 }
+
+//MustLoadTOTP load totp secret of given uid.
+//Return nil if not found.
+func (u *Users) MustLoadTOTP(uid string) *totp.Secret {
+	u.locker.RLock()
+	defer u.locker.RUnlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	if us.TOTP == nil {
+		return nil
+	}
+	secret := *us.TOTP
+	return &secret
+}
+
+//MustSaveTOTP save totp secret of given uid.
+func (u *Users) MustSaveTOTP(uid string, secret *totp.Secret) {
+	u.mustWritable()
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	data := *secret
+	us.TOTP = &data
+	u.mustSave()
+}
+
+//MustRemoveTOTP remove totp secret of given uid.
+func (u *Users) MustRemoveTOTP(uid string) {
+	u.mustWritable()
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	us.TOTP = nil
+	u.mustSave()
+}
+
+//MustUseTOTPCounter set last used counter of given uid if counter larger than stored one.
+//Return whether counter updated.
+func (u *Users) MustUseTOTPCounter(uid string, counter int64) bool {
+	u.mustWritable()
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	if us.TOTP == nil || us.TOTP.LastCounter >= counter {
+		return false
+	}
+	us.TOTP.LastCounter = counter
+	u.mustSave()
+	return true
+}
+
+//MustLoadRecoveryCodes load recovery code hashes of given uid.
+func (u *Users) MustLoadRecoveryCodes(uid string) []string {
+	u.locker.RLock()
+	defer u.locker.RUnlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	result := make([]string, len(us.RecoveryCodes))
+	copy(result, us.RecoveryCodes)
+	return result
+}
+
+//MustReplaceRecoveryCodes replace all recovery code hashes of given uid.
+func (u *Users) MustReplaceRecoveryCodes(uid string, hashes []string) {
+	u.mustWritable()
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	us.RecoveryCodes = make([]string, len(hashes))
+	copy(us.RecoveryCodes, hashes)
+	u.mustSave()
+}
+
+//MustUseRecoveryCode remove given recovery code hash of given uid.
+//Return whether hash existed.
+func (u *Users) MustUseRecoveryCode(uid string, hash string) bool {
+	u.mustWritable()
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	us := u.uidmap[uid]
+	if us == nil {
+		panic(user.ErrUserNotExists)
+	}
+	for k := range us.RecoveryCodes {
+		if us.RecoveryCodes[k] == hash {
+			us.RecoveryCodes = append(us.RecoveryCodes[:k], us.RecoveryCodes[k+1:]...)
+			u.mustSave()
+			return true
+		}
+	}
+	return false
+}
@@ -2,20 +2,27 @@ package tomluser_test
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/herb-go/herbsecurity/authorize/role"
 	"github.com/herb-go/herbsystem"
 	"github.com/herb-go/user"
+	"github.com/herb-go/user/profile"
 
 	"github.com/herb-go/providers/herb/statictoml"
 	"github.com/herb-go/user/status"
 	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/recoverycode"
 	"github.com/herb-go/usersystem-drivers/tomluser"
+	"github.com/herb-go/usersystem-drivers/totp"
 	"github.com/herb-go/usersystem/modules/useraccount"
 	"github.com/herb-go/usersystem/modules/userpassword"
 	"github.com/herb-go/usersystem/modules/userprofile"
@@ -360,4 +367,1065 @@ func TestHash(t *testing.T) {
 	if err != nil || p != hex.EncodeToString(d[:]) {
 		t.Fatal(p, err)
 	}
+	_, err = tomluser.HashStrict("unknown", "1234", u)
+	if !errors.Is(err, tomluser.ErrUnknownHashMode) {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{"md5", "sha256", "bcrypt", "argon2id"} {
+		err = u.UpdatePasswordStrict(mode, "1234")
+		if err != nil {
+			t.Fatal(mode, err)
+		}
+		if u.Password == "1234" || u.IsPlaintext() {
+			t.Fatal(mode, u.Password)
+		}
+		ok, err := u.VerifyPassword("1234")
+		if !ok || err != nil {
+			t.Fatal(mode, ok, err)
+		}
+		ok, err = u.VerifyPassword("12345")
+		if ok || err != nil {
+			t.Fatal(mode, ok, err)
+		}
+	}
+	err = u.UpdatePassword("plain", "1234")
+	if err != nil || !u.IsPlaintext() {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradePlaintext(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte("[[Users]]\nUID=\"test\"\nPassword=\"1234\"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	c := testConfig(source)
+	c.HashMode = "unknown"
+	c.StrictHash = true
+	_, err = c.Load()
+	if !errors.Is(err, tomluser.ErrUnknownHashMode) {
+		t.Fatal(err)
+	}
+	c.HashMode = "argon2id"
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uids := u.PlaintextUsers(); len(uids) != 1 || uids[0] != "test" {
+		t.Fatal(uids)
+	}
+	if !u.MustVerifyPassword("test", "1234") {
+		t.Fatal()
+	}
+	if n := u.MustUpgradePlaintext(); n != 1 {
+		t.Fatal(n)
+	}
+	tomluser.Flush()
+	u, err = c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uids := u.PlaintextUsers(); len(uids) != 0 {
+		t.Fatal(uids)
+	}
+	if !u.MustVerifyPassword("test", "1234") || u.MustVerifyPassword("test", "12345") {
+		t.Fatal()
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	s := usersystem.New()
+	userstatus.MustNewAndInstallTo(s)
+	service := totp.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	c := testConfig(source)
+	c.ServeTOTP = true
+	err = c.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	now := time.Now()
+	service.Clock = func() time.Time {
+		return now
+	}
+	err = herbsystem.Catch(func() {
+		service.MustEnroll("test")
+	})
+	if err != user.ErrUserNotExists {
+		t.Fatal(err)
+	}
+	usercreate.MustExecCreate(s, "test")
+	e := service.MustEnroll("test")
+	key, err := totp.DecodeSecret(e.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totp.HOTP(key, totp.Counter(now, service.Period), service.Digits)
+	if !service.MustConfirm("test", code) {
+		t.Fatal()
+	}
+	if service.MustVerify("test", code) {
+		t.Fatal()
+	}
+	tomluser.Flush()
+	u, err := testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := u.MustLoadTOTP("test")
+	if secret == nil || !secret.Confirmed || secret.Secret != e.Secret || secret.LastCounter != totp.Counter(now, service.Period) {
+		t.Fatal(secret)
+	}
+	service.MustDisable("test")
+	if service.MustEnabled("test") {
+		t.Fatal()
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	s := usersystem.New()
+	userstatus.MustNewAndInstallTo(s)
+	service := recoverycode.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	c := testConfig(source)
+	c.ServeRecoveryCodes = true
+	err = c.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	herbsystem.MustStart(s)
+	defer herbsystem.MustStop(s)
+	usercreate.MustExecCreate(s, "test")
+	codes := service.MustGenerate("test")
+	if !service.MustConsume("test", codes[0]) || service.MustConsume("test", codes[0]) {
+		t.Fatal()
+	}
+	tomluser.Flush()
+	u, err := testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := u.MustLoadRecoveryCodes("test")
+	if len(hashes) != len(codes)-1 {
+		t.Fatal(hashes)
+	}
+	for _, v := range hashes {
+		if v == codes[1] || v == recoverycode.Hash(codes[0]) {
+			t.Fatal(v)
+		}
+	}
+	if !u.MustUseRecoveryCode("test", recoverycode.Hash(codes[1])) {
+		t.Fatal()
+	}
+}
+
+func TestReload(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	c := testConfig(source)
+	c.Watch = true
+	c.WatchIntervalInSecond = 1
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan []string, 10)
+	u.AddReloadCallback(func(uids []string) {
+		reloaded <- uids
+	})
+	removed := make(chan []string, 10)
+	remove := u.AddReloadCallback(func(uids []string) {
+		removed <- uids
+	})
+	remove()
+	remove()
+	reloaderrors := make(chan error, 10)
+	u.OnReloadError = func(err error) {
+		reloaderrors <- err
+	}
+	err = u.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Stop()
+	err = ioutil.WriteFile(string(source), []byte("[[Users]]\nUID = \"test\"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case uids := <-reloaded:
+		if len(uids) != 1 || uids[0] != "test" {
+			t.Fatal(uids)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reloaded")
+	}
+	st, ok := u.MustLoadStatus("test")
+	if !ok || st != status.StatusNormal {
+		t.Fatal(st, ok)
+	}
+	if len(removed) != 0 {
+		t.Fatal(<-removed)
+	}
+	err = ioutil.WriteFile(string(source), []byte("[[Users"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-reloaderrors:
+		if err == nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error not reported")
+	}
+	u.Stop()
+	_, err = u.Reload()
+	if err == nil {
+		t.Fatal(err)
+	}
+	_, ok = u.MustLoadStatus("test")
+	if !ok {
+		t.Fatal(ok)
+	}
+}
+
+func TestReloadAccounts(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	data := "[[Users]]\nUID = \"alice\"\n[[Users.Accounts]]\nKeyword = \"email\"\nAccount = \"shared\"\n" +
+		"[[Users]]\nUID = \"bob\"\n[[Users.Accounts]]\nKeyword = \"phone\"\nAccount = \"shared\"\n"
+	err = ioutil.WriteFile(string(source), []byte(data), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	u, err := testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := user.NewAccount()
+	email.Keyword = "email"
+	email.Account = "shared"
+	phone := user.NewAccount()
+	phone.Keyword = "phone"
+	phone.Account = "shared"
+	name := user.NewAccount()
+	name.Keyword = "name"
+	name.Account = "alice"
+	u.MustBindAccount("alice", name)
+	for i := 0; i < 2; i++ {
+		_, err = u.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.MustAccountToUID(email) != "alice" || u.MustAccountToUID(phone) != "bob" || u.MustAccountToUID(name) != "alice" {
+			t.Fatal(i)
+		}
+	}
+	u.MustRemoveStatus("bob")
+	if u.MustAccountToUID(phone) != "" || u.MustAccountToUID(email) != "alice" {
+		t.Fatal()
+	}
+	_, err = u.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.MustAccountToUID(phone) != "" || u.MustAccountToUID(email) != "alice" {
+		t.Fatal()
+	}
+	u.MustBindAccount("alice", phone)
+	if u.MustAccountToUID(phone) != "alice" {
+		t.Fatal()
+	}
+}
+
+func TestSave(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	c := testConfig(source)
+	c.Backups = 2
+	c.SaveDelayInMillisecond = 60000
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.MustCreateStatus("test1")
+	u.MustCreateStatus("test2")
+	data := tomluser.NewData()
+	err = tomluser.TOMLSource(source).Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Users) != 0 {
+		t.Fatal(data.Users)
+	}
+	err = u.SaveNow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tomluser.Flush()
+	loaded, err := testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"test1", "test2"} {
+		_, ok := loaded.MustLoadStatus(v)
+		if !ok {
+			t.Fatal(v)
+		}
+	}
+	u.SetSaveDelay(0)
+	u.MustCreateStatus("test3")
+	u.MustCreateStatus("test4")
+	for _, v := range []int{1, 2} {
+		_, err = os.Stat(tomluser.BackupPath(string(source), v))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = os.Stat(tomluser.BackupPath(string(source), 3))
+	if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatal(len(files))
+	}
+}
+
+func TestPersistRolesAndTerms(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	u, err := testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.MustCreateStatus("test")
+	u.MustUpdatePassword("test", "password")
+	u.MustGrantRoles("test", role.NewRole("role1"), role.NewRole("role2"))
+	u.MustGrantRoles("test", role.NewRole("role2"), role.NewRole("role3"))
+	if n := u.MustRevokeRoles("test", "role1", "notexist"); n != 1 {
+		t.Fatal(n)
+	}
+	term := u.MustStartNewTerm("test")
+	err = herbsystem.Catch(func() {
+		u.MustGrantRoles("notexist", role.NewRole("role1"))
+	})
+	if err != user.ErrUserNotExists {
+		t.Fatal(err)
+	}
+	tomluser.Flush()
+	loaded, err := testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := loaded.MustRoles("test")
+	if len(*r) != 2 || !r.Contains(role.NewRoles(role.NewRole("role2"), role.NewRole("role3"))) || r.Contains(role.NewRoles(role.NewRole("role1"))) {
+		t.Fatal(r)
+	}
+	if loaded.MustCurrentTerm("test") != term {
+		t.Fatal(loaded.MustCurrentTerm("test"))
+	}
+	if !loaded.MustVerifyPassword("test", "password") {
+		t.Fatal()
+	}
+	loaded.MustReplaceRoles("test", role.NewRoles(role.NewRole("role4")))
+	tomluser.Flush()
+	loaded, err = testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = loaded.MustRoles("test")
+	if len(*r) != 1 || !r.Contains(role.NewRoles(role.NewRole("role4"))) {
+		t.Fatal(r)
+	}
+}
+
+func TestSourceFormats(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tomluser.Flush()
+	for _, name := range []string{"test.json", "test.yaml", "test.yml", "test.static.toml"} {
+		example := statictoml.Source(path.Join(dir, "example."+name))
+		err = ioutil.WriteFile(string(example), []byte(""), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := statictoml.Source(path.Join(dir, name))
+		if tomluser.DetectFormat(name) == tomluser.FormatTOML {
+			err = ioutil.WriteFile(string(source), []byte(""), 0700)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		c := testConfig(source)
+		c.Example = example
+		u, err := c.Load()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		u.MustCreateStatus("test")
+		u.MustUpdatePassword("test", "password")
+		u.MustGrantRoles("test", role.NewRole("role1"))
+		u.MustBindAccount("test", user.NewAccount())
+		tomluser.Flush()
+		u, err = c.Load()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if !u.MustVerifyPassword("test", "password") {
+			t.Fatal(name)
+		}
+		r := u.MustRoles("test")
+		if !r.Contains(role.NewRoles(role.NewRole("role1"))) {
+			t.Fatal(name, r)
+		}
+		if len(*u.MustAccounts("test")) != 1 {
+			t.Fatal(name)
+		}
+	}
+	c := testConfig(statictoml.Source(path.Join(dir, "test.txt")))
+	c.Format = "unknown"
+	_, err = c.Load()
+	if !errors.Is(err, tomluser.ErrUnknownSourceFormat) {
+		t.Fatal(err)
+	}
+}
+
+func TestYAMLSource(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tomluser.Flush()
+	content := `Users:
+- UID: alice
+  Password: "1234"
+  Banned: true
+  Term: term1
+  Accounts:
+  - Keyword: name
+    Account: alice
+  Roles:
+  - Name: role1
+  RecoveryCodes:
+  - code1
+`
+	source := statictoml.Source(path.Join(dir, "test.yaml"))
+	err = ioutil.WriteFile(string(source), []byte(content), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(source)
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.MustVerifyPassword("alice", "1234") {
+		t.Fatal()
+	}
+	st, ok := u.MustLoadStatus("alice")
+	if !ok || st != status.StatusBanned {
+		t.Fatal(st, ok)
+	}
+	if term := u.MustCurrentTerm("alice"); term != "term1" {
+		t.Fatal(term)
+	}
+	acc := user.NewAccount()
+	acc.Keyword = "name"
+	acc.Account = "alice"
+	if uid := u.MustAccountToUID(acc); uid != "alice" {
+		t.Fatal(uid)
+	}
+	r := u.MustRoles("alice")
+	if !r.Contains(role.NewRoles(role.NewRole("role1"))) {
+		t.Fatal(r)
+	}
+	u.MustUpdatePassword("alice", "12345")
+	tomluser.Flush()
+	data, err := ioutil.ReadFile(string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"UID: alice", "Keyword: name", "Name: role1", "RecoveryCodes:"} {
+		if !strings.Contains(string(data), v) {
+			t.Fatal(v, string(data))
+		}
+	}
+	u, err = c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.MustVerifyPassword("alice", "12345") {
+		t.Fatal()
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tomluser.Flush()
+	alice := []byte("Password=\"1234\"\n[[Accounts]]\nKeyword=\"name\"\nAccount=\"alice\"\n")
+	err = ioutil.WriteFile(path.Join(dir, "alice.toml"), alice, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(statictoml.Source(dir))
+	c.Directory = true
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.MustVerifyPassword("alice", "1234") {
+		t.Fatal()
+	}
+	u.MustCreateStatus("bob")
+	u.MustUpdatePassword("bob", "password")
+	data, err := ioutil.ReadFile(path.Join(dir, "alice.toml"))
+	if err != nil || string(data) != string(alice) {
+		t.Fatal(string(data), err)
+	}
+	tomluser.Flush()
+	loaded, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.MustVerifyPassword("bob", "password") || !loaded.MustVerifyPassword("alice", "1234") {
+		t.Fatal()
+	}
+	err = herbsystem.Catch(func() {
+		u.MustCreateStatus("../test")
+	})
+	if !errors.Is(err, tomluser.ErrInvalidUID) {
+		t.Fatal(err)
+	}
+	_, ok := u.MustLoadStatus("../test")
+	if ok {
+		t.Fatal(ok)
+	}
+	bobaccount := user.NewAccount()
+	bobaccount.Keyword = "name"
+	bobaccount.Account = "bob"
+	u.MustBindAccount("bob", bobaccount)
+	u.MustRemoveStatus("bob")
+	_, err = os.Stat(path.Join(dir, "bob.toml"))
+	if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if u.MustAccountToUID(bobaccount) != "" {
+		t.Fatal()
+	}
+	u.MustCreateStatus("bob")
+	u.MustBindAccount("bob", bobaccount)
+	err = os.Remove(path.Join(dir, "bob.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = u.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok = u.MustLoadStatus("bob")
+	if ok || u.MustAccountToUID(bobaccount) != "" {
+		t.Fatal(ok)
+	}
+	aliceaccount := user.NewAccount()
+	aliceaccount.Keyword = "name"
+	aliceaccount.Account = "alice"
+	if u.MustAccountToUID(aliceaccount) != "alice" {
+		t.Fatal()
+	}
+	err = ioutil.WriteFile(path.Join(dir, "carol.toml"), alice, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tomluser.Flush()
+	_, err = c.Load()
+	if !errors.Is(err, tomluser.ErrDuplicateAccount) {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path.Join(dir, "carol.toml"), []byte("UID=\"dave\"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tomluser.Flush()
+	_, err = c.Load()
+	if !errors.Is(err, tomluser.ErrUIDMismatch) {
+		t.Fatal(err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte("[[Users]]\nUID=\"test\"\n"), 0400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tomluser.Flush()
+	s := usersystem.New()
+	upassword := userpassword.MustNewAndInstallTo(s)
+	ustatus := userstatus.MustNewAndInstallTo(s)
+	uterm := userterm.MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	c := testConfig(source)
+	c.ReadOnly = true
+	err = c.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uterm.Service != nil {
+		t.Fatal(uterm.Service)
+	}
+	if upassword.Service.PasswordChangeable() {
+		t.Fatal()
+	}
+	_, ok := ustatus.MustLoadStatus("test")
+	if !ok {
+		t.Fatal(ok)
+	}
+	u := ustatus.Service.(*tomluser.Users)
+	for _, f := range []func(){
+		func() { u.MustCreateStatus("new") },
+		func() { u.MustUpdateStatus("test", status.StatusBanned) },
+		func() { u.MustUpdatePassword("test", "password") },
+		func() { u.MustGrantRoles("test", role.NewRole("role")) },
+		func() { u.MustBindAccount("test", user.NewAccount()) },
+	} {
+		err = herbsystem.Catch(f)
+		if err != tomluser.ErrReadOnly {
+			t.Fatal(err)
+		}
+	}
+	if u.SetRoles("test", nil) != tomluser.ErrReadOnly {
+		t.Fatal()
+	}
+	st, _ := u.MustLoadStatus("test")
+	if st != status.StatusNormal {
+		t.Fatal(st)
+	}
+	example := statictoml.Source(path.Join(dir, "example.static.toml"))
+	err = ioutil.WriteFile(string(example), []byte("[[Users]]\nUID=\"example\"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := statictoml.Source(path.Join(dir, "missing.static.toml"))
+	c = testConfig(missing)
+	c.Example = example
+	c.ReadOnly = true
+	_, err = c.Load()
+	if err == nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(string(missing))
+	if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tomluser.Flush()
+	secretfile := path.Join(dir, "salt")
+	err = ioutil.WriteFile(secretfile, []byte("salt\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := sha256.Sum256([]byte("1234" + "salt"))
+	os.Setenv("TOMLUSER_TEST_PASSWORD", hex.EncodeToString(d[:]))
+	defer os.Unsetenv("TOMLUSER_TEST_PASSWORD")
+	content := "[[Users]]\nUID=\"test\"\nHashMode=\"sha256\"\nPassword=\"env:TOMLUSER_TEST_PASSWORD\"\nSalt=\"file:" + secretfile + "\"\n"
+	content = content + "[[Users]]\nUID=\"plain\"\nPassword=\"env:TOMLUSER_TEST_PASSWORD\"\n"
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(content), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(source)
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.MustVerifyPassword("test", "1234") {
+		t.Fatal()
+	}
+	if !u.MustVerifyPassword("plain", "env:TOMLUSER_TEST_PASSWORD") {
+		t.Fatal()
+	}
+	u.MustGrantRoles("test", role.NewRole("role"))
+	data, err := ioutil.ReadFile(string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), "env:TOMLUSER_TEST_PASSWORD") != 2 || !strings.Contains(string(data), "file:"+secretfile) || strings.Contains(string(data), hex.EncodeToString(d[:])) {
+		t.Fatal(string(data))
+	}
+	u.MustUpdatePassword("test", "5678")
+	data, err = ioutil.ReadFile(string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), "env:TOMLUSER_TEST_PASSWORD") != 1 || strings.Contains(string(data), "file:"+secretfile) {
+		t.Fatal(string(data))
+	}
+	err = ioutil.WriteFile(string(source), []byte(content), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("TOMLUSER_TEST_PASSWORD")
+	tomluser.Flush()
+	_, err = c.Load()
+	if !errors.Is(err, tomluser.ErrUnresolvedSecret) {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileSchema(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tomluser.Flush()
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(source)
+	c.ProfileSchema = []*tomluser.ProfileField{
+		&tomluser.ProfileField{Name: "email", Type: tomluser.ProfileTypeEmail, Required: true},
+		&tomluser.ProfileField{Name: "site", Type: tomluser.ProfileTypeURL, Multiple: true},
+		&tomluser.ProfileField{Name: "age", Type: tomluser.ProfileTypeInt},
+		&tomluser.ProfileField{Name: "nickname", MaxLength: 5},
+	}
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.MustCreateStatus("test")
+	p := profile.NewProfile().
+		With("email", "test@example.com").
+		With("site", "https://example.com").
+		With("site", "https://example.org").
+		With("age", "18").
+		With("nickname", "test")
+	u.MustUpdateProfile("test", p)
+	for _, v := range []struct {
+		profile *profile.Profile
+		field   string
+	}{
+		{profile.NewProfile().With("site", "https://example.com"), "email"},
+		{profile.NewProfile().With("email", "notemail"), "email"},
+		{profile.NewProfile().With("email", "test@example.com").With("email", "test2@example.com"), "email"},
+		{profile.NewProfile().With("email", "test@example.com").With("site", "example.com"), "site"},
+		{profile.NewProfile().With("email", "test@example.com").With("age", "old"), "age"},
+		{profile.NewProfile().With("email", "test@example.com").With("nickname", "toolong"), "nickname"},
+		{profile.NewProfile().With("email", "test@example.com").With("unknown", "value"), "unknown"},
+	} {
+		err = herbsystem.Catch(func() {
+			u.MustUpdateProfile("test", v.profile)
+		})
+		var perr *tomluser.ProfileError
+		if !errors.As(err, &perr) || perr.Field != v.field {
+			t.Fatal(v.field, err)
+		}
+	}
+	tomluser.Flush()
+	loaded, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.MustGetProfile("test").Data()) != 5 {
+		t.Fatal(loaded.MustGetProfile("test").Data())
+	}
+	loaded.MustCreateStatus("noemail")
+	tomluser.Flush()
+	loaded, err = c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.MustGetProfile("noemail").Data()) != 0 {
+		t.Fatal(loaded.MustGetProfile("noemail").Data())
+	}
+	err = herbsystem.Catch(func() {
+		loaded.MustUpdateProfile("noemail", profile.NewProfile().With("age", "18"))
+	})
+	var perr *tomluser.ProfileError
+	if !errors.As(err, &perr) || perr.Field != "email" {
+		t.Fatal(err)
+	}
+	tomluser.Flush()
+	nonschema := testConfig(source)
+	nonschema.ProfileFields = []string{"age"}
+	loaded, err = nonschema.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.MustUpdateProfile("noemail", profile.NewProfile().With("age", "18"))
+	tomluser.Flush()
+	_, err = c.Load()
+	if !errors.As(err, &perr) || perr.Field != "email" {
+		t.Fatal(err)
+	}
+	c.ProfileSchema = []*tomluser.ProfileField{&tomluser.ProfileField{Name: "test", Type: "unknown"}}
+	tomluser.Flush()
+	_, err = c.Load()
+	if !errors.As(err, &perr) || perr.Field != "test" {
+		t.Fatal(err)
+	}
+}
+
+func TestShared(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tomluser.Flush()
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u1, err := testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u2, err := testConfig(statictoml.Source(path.Join(dir, ".", "test.static.toml"))).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u1 != u2 {
+		t.Fatal(u1, u2)
+	}
+	u1.MustCreateStatus("test1")
+	u2.MustCreateStatus("test2")
+	tomluser.Release(u1)
+	u3, err := testConfig(source).Load()
+	if err != nil || u3 != u2 {
+		t.Fatal(u3, err)
+	}
+	tomluser.Release(u2)
+	tomluser.Release(u3)
+	u4, err := testConfig(source).Load()
+	if err != nil || u4 == u1 {
+		t.Fatal(u4, err)
+	}
+	for _, v := range []string{"test1", "test2"} {
+		_, ok := u4.MustLoadStatus(v)
+		if !ok {
+			t.Fatal(v)
+		}
+	}
+	c := testConfig(source)
+	c.Watch = true
+	tomluser.Flush()
+	u, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = testConfig(source).Load()
+	if !errors.Is(err, tomluser.ErrConflictingOptions) {
+		t.Fatal(err)
+	}
+	readonly := testConfig(source)
+	readonly.Watch = true
+	readonly.ReadOnly = true
+	_, err = readonly.Load()
+	if !errors.Is(err, tomluser.ErrConflictingOptions) {
+		t.Fatal(err)
+	}
+	u.Start()
+	u.Start()
+	u.Stop()
+	u.MustCreateStatus("test3")
+	u.Stop()
+	tomluser.Release(u)
+	loaded, err := testConfig(source).Load()
+	if err != nil || loaded == u {
+		t.Fatal(loaded, err)
+	}
+	_, ok := loaded.MustLoadStatus("test3")
+	if !ok {
+		t.Fatal(ok)
+	}
+	tomluser.Release(loaded)
+	c = testConfig(source)
+	c.SaveDelayInMillisecond = 60000
+	u, err = c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.MustCreateStatus("test4")
+	tomluser.Flush()
+	loaded, err = testConfig(source).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok = loaded.MustLoadStatus("test4")
+	if !ok {
+		t.Fatal(ok)
+	}
+}
+
+func TestSharedBySystems(t *testing.T) {
+	var err error
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tomluser.Flush()
+	source := statictoml.Source(path.Join(dir, "test.static.toml"))
+	err = ioutil.WriteFile(string(source), []byte(""), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(source)
+	c.Watch = true
+	c.WatchIntervalInSecond = 1
+	var systems []*usersystem.UserSystem
+	var users []*tomluser.Users
+	for i := 0; i < 2; i++ {
+		s := usersystem.New()
+		ustatus := userstatus.MustNewAndInstallTo(s)
+		herbsystem.MustReady(s)
+		herbsystem.MustConfigure(s)
+		err = c.Execute(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		herbsystem.MustStart(s)
+		systems = append(systems, s)
+		users = append(users, ustatus.Service.(*tomluser.Users))
+	}
+	u := users[0]
+	if users[1] != u {
+		t.Fatal()
+	}
+	purged := make(chan []string, 10)
+	u.AddReloadCallback(func(uids []string) {
+		purged <- uids
+	})
+	herbsystem.MustStop(systems[0])
+	err = ioutil.WriteFile(string(source), []byte("[[Users]]\nUID = \"test\"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case uids := <-purged:
+		if len(uids) != 1 || uids[0] != "test" {
+			t.Fatal(uids)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reloaded")
+	}
+	_, ok := u.MustLoadStatus("test")
+	if !ok {
+		t.Fatal(ok)
+	}
+	herbsystem.MustStop(systems[1])
+	loaded, err := testConfig(source).Load()
+	if err != nil || loaded == u {
+		t.Fatal(loaded, err)
+	}
 }
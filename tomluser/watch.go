@@ -0,0 +1,174 @@
+package tomluser
+
+import (
+	"log"
+	"os"
+	"reflect"
+	"time"
+)
+
+//DefaultWatchInterval default interval to check source file when watching.
+var DefaultWatchInterval = 2 * time.Second
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+	count   int
+}
+
+func statSource(path string) (fileStat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	return fileStat{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func changedUsers(old map[string]*User, current map[string]*User) []string {
+	var result []string
+	for k := range old {
+		u := current[k]
+		if u == nil || !reflect.DeepEqual(old[k], u) {
+			result = append(result, k)
+		}
+	}
+	for k := range current {
+		if old[k] == nil {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+//Reload re-parse source file and replace all users atomically.
+//Source will be verified with example first.
+//Loaded users will be kept if any error raised.
+//Reload callbacks will be called with changed uids after users replaced.
+//Return changed uids and any error if raised.
+func (u *Users) Reload() ([]string, error) {
+	stat, err := u.statSource()
+	if err != nil {
+		return nil, err
+	}
+	if u.Example != nil {
+		err = u.Source.VerifyWithExample(u.Example)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := u.loadData()
+	if err != nil {
+		return nil, err
+	}
+	u.locker.Lock()
+	loaded := NewUsers()
+	for k := range data.Users {
+		loaded.addUser(data.Users[k])
+	}
+	changed := changedUsers(u.uidmap, loaded.uidmap)
+	u.uidmap = loaded.uidmap
+	u.accountmap = loaded.accountmap
+	u.stat = stat
+	u.snapshot()
+	callbacks := u.callbacks
+	u.locker.Unlock()
+	if len(changed) != 0 {
+		for _, c := range callbacks {
+			c.callback(changed)
+		}
+	}
+	return changed, nil
+}
+
+type reloadCallback struct {
+	callback func(uids []string)
+}
+
+//AddReloadCallback add callback which will be called with changed uids after source reloaded.
+//Return function which removes added callback.
+func (u *Users) AddReloadCallback(callback func(uids []string)) func() {
+	c := &reloadCallback{callback: callback}
+	u.locker.Lock()
+	defer u.locker.Unlock()
+	u.callbacks = append(u.callbacks, c)
+	return func() {
+		u.locker.Lock()
+		defer u.locker.Unlock()
+		for k, v := range u.callbacks {
+			if v == c {
+				//Callbacks should be copied,as reloading may be calling them outside lock.
+				u.callbacks = append(u.callbacks[:k:k], u.callbacks[k+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (u *Users) reloadError(err error) {
+	if u.OnReloadError != nil {
+		u.OnReloadError(err)
+		return
+	}
+	log.Printf("tomluser: reload %s failed: %s", u.Source.Path(), err)
+}
+
+func (u *Users) sourceChanged() bool {
+	stat, err := u.statSource()
+	if err != nil {
+		return false
+	}
+	u.locker.RLock()
+	defer u.locker.RUnlock()
+	//Pending changes in batched save mode will overwrite source.
+	return stat != u.stat && !u.dirty
+}
+
+func (u *Users) watch(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if u.sourceChanged() {
+				_, err := u.Reload()
+				if err != nil {
+					u.reloadError(err)
+				}
+			}
+		}
+	}
+}
+
+//Watch start watching source file with given interval.
+//Source file will be reloaded when modified time or size changed.
+//DefaultWatchInterval will be used if interval is not positive.
+//Watching started already will be stopped.
+func (u *Users) Watch(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	u.Unwatch()
+	u.watchLocker.Lock()
+	defer u.watchLocker.Unlock()
+	stop := make(chan struct{})
+	u.stopWatch = stop
+	go u.watch(interval, stop)
+}
+
+func (u *Users) watching() bool {
+	u.watchLocker.Lock()
+	defer u.watchLocker.Unlock()
+	return u.stopWatch != nil
+}
+
+//Unwatch stop watching source file.
+func (u *Users) Unwatch() {
+	u.watchLocker.Lock()
+	defer u.watchLocker.Unlock()
+	if u.stopWatch != nil {
+		close(u.stopWatch)
+		u.stopWatch = nil
+	}
+}
@@ -0,0 +1,98 @@
+package totp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/storemodule"
+)
+
+//ErrInvalidPeriod error raised when period less than one second.
+var ErrInvalidPeriod = errors.New("totp:period should not be less than one second")
+
+//ModuleName totp module name.
+const ModuleName = "totp"
+
+//TOTP totp usersystem module.
+//Store will be started and stopped with usersystem if it implements Start or Stop method.
+type TOTP struct {
+	storemodule.Module
+	*Service
+}
+
+//New create new totp module.
+func New() *TOTP {
+	t := &TOTP{
+		Service: NewService(),
+	}
+	t.Module = storemodule.New(ModuleName, func() interface{} { return t.Store })
+	return t
+}
+
+//MustNewAndInstallTo create new totp module and install to given usersystem.
+func MustNewAndInstallTo(s *usersystem.UserSystem) *TOTP {
+	t := New()
+	storemodule.MustInstallTo(s, t)
+	return t
+}
+
+//MustGetModule get totp module installed to given usersystem.
+//Return nil if not installed.
+func MustGetModule(s *usersystem.UserSystem) *TOTP {
+	m := storemodule.MustGetModule(s, ModuleName)
+	if m == nil {
+		return nil
+	}
+	return m.(*TOTP)
+}
+
+//Config totp directive config.
+//Totp module should be installed before directive executed.
+type Config struct {
+	Issuer       string
+	Digits       int
+	Period       string
+	Skew         *int
+	SecretLength int
+}
+
+//Execute apply config to totp module installed to usersystem.
+func (c *Config) Execute(s *usersystem.UserSystem) error {
+	service := MustGetModule(s)
+	if service == nil {
+		return fmt.Errorf("%w (%s)", storemodule.ErrModuleNotInstalled, ModuleName)
+	}
+	service.Issuer = c.Issuer
+	if c.Digits > 0 {
+		service.Digits = c.Digits
+	}
+	if c.Period != "" {
+		d, err := time.ParseDuration(c.Period)
+		if err != nil {
+			return err
+		}
+		if d < time.Second {
+			return ErrInvalidPeriod
+		}
+		service.Period = d
+	}
+	if c.Skew != nil {
+		service.Skew = *c.Skew
+	}
+	if c.SecretLength > 0 {
+		service.SecretLength = c.SecretLength
+	}
+	return nil
+}
+
+//DirectiveFactory factory to create totp directive
+var DirectiveFactory = func(loader func(v interface{}) error) (usersystem.Directive, error) {
+	c := &Config{}
+	err := loader(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,177 @@
+package totp
+
+import (
+	"errors"
+	"time"
+)
+
+//ErrNotEnrolled error raised when user not enrolled.
+var ErrNotEnrolled = errors.New("totp:user not enrolled")
+
+//ErrAlreadyEnabled error raised when enrolling user whose totp already enabled.
+var ErrAlreadyEnabled = errors.New("totp:totp already enabled")
+
+//ErrStoreNotSet error raised when totp store not set.
+var ErrStoreNotSet = errors.New("totp:store not set")
+
+//Secret user totp secret data.
+type Secret struct {
+	//Secret base32 encoded secret.
+	Secret string
+	//Confirmed whether user confirmed the secret with a valid code.
+	Confirmed bool
+	//LastCounter last used time step counter.
+	//Codes with counter not larger than LastCounter will be rejected.
+	LastCounter int64
+	//CreatedTime created timestamp in second.
+	CreatedTime int64
+}
+
+//Store totp secret store interface
+type Store interface {
+	//MustLoadTOTP load totp secret of given uid.
+	//Return nil if not found.
+	MustLoadTOTP(uid string) *Secret
+	//MustSaveTOTP save totp secret of given uid.
+	MustSaveTOTP(uid string, secret *Secret)
+	//MustRemoveTOTP remove totp secret of given uid.
+	MustRemoveTOTP(uid string)
+	//MustUseTOTPCounter set last used counter of given uid if counter larger than stored one.
+	//Return whether counter updated.
+	MustUseTOTPCounter(uid string, counter int64) bool
+}
+
+//Enrollment enrollment info returned to user.
+type Enrollment struct {
+	//Secret base32 encoded secret.
+	Secret string
+	//URI otpauth key uri.
+	URI string
+}
+
+//Service totp service
+type Service struct {
+	//Store secret store.
+	Store Store
+	//Issuer issuer shown in authenticator apps.
+	Issuer string
+	//Digits code digits.
+	//default value is 6.
+	Digits int
+	//Period time step.
+	//default value is 30 seconds.
+	Period time.Duration
+	//Skew accepted time steps before and after current step.
+	//default value is 1.
+	Skew int
+	//SecretLength secret length in bytes.
+	SecretLength int
+	//Clock clock source.
+	//default value is time.Now.
+	Clock func() time.Time
+}
+
+func (s *Service) store() Store {
+	if s.Store == nil {
+		panic(ErrStoreNotSet)
+	}
+	return s.Store
+}
+
+//MustEnroll create new unconfirmed secret for given uid.
+//Previous unconfirmed secret will be overwritten.
+//If totp already enabled,ErrAlreadyEnabled will be raised.
+func (s *Service) MustEnroll(uid string) *Enrollment {
+	store := s.store()
+	current := store.MustLoadTOTP(uid)
+	if current != nil && current.Confirmed {
+		panic(ErrAlreadyEnabled)
+	}
+	secret, err := NewSecret(s.SecretLength)
+	if err != nil {
+		panic(err)
+	}
+	store.MustSaveTOTP(uid, &Secret{
+		Secret:      secret,
+		CreatedTime: s.Clock().Unix(),
+	})
+	return &Enrollment{
+		Secret: secret,
+		URI:    KeyURI(s.Issuer, uid, secret, s.Digits, s.Period),
+	}
+}
+
+func (s *Service) match(uid string, secret *Secret, code string) bool {
+	key, err := DecodeSecret(secret.Secret)
+	if err != nil {
+		panic(err)
+	}
+	counter := Counter(s.Clock(), s.Period)
+	for i := -s.Skew; i <= s.Skew; i++ {
+		c := counter + int64(i)
+		if c <= secret.LastCounter {
+			continue
+		}
+		if Equal(HOTP(key, c, s.Digits), code) {
+			return s.store().MustUseTOTPCounter(uid, c)
+		}
+	}
+	return false
+}
+
+//MustConfirm confirm enrolled secret with given code.
+//Return whether code is valid.
+//If user not enrolled,ErrNotEnrolled will be raised.
+func (s *Service) MustConfirm(uid string, code string) bool {
+	store := s.store()
+	secret := store.MustLoadTOTP(uid)
+	if secret == nil {
+		panic(ErrNotEnrolled)
+	}
+	if secret.Confirmed {
+		return s.match(uid, secret, code)
+	}
+	if !s.match(uid, secret, code) {
+		return false
+	}
+	secret = store.MustLoadTOTP(uid)
+	if secret == nil {
+		panic(ErrNotEnrolled)
+	}
+	secret.Confirmed = true
+	store.MustSaveTOTP(uid, secret)
+	return true
+}
+
+//MustVerify verify code of given uid.
+//Code used once will be rejected.
+//Return false if totp not enabled.
+func (s *Service) MustVerify(uid string, code string) bool {
+	secret := s.store().MustLoadTOTP(uid)
+	if secret == nil || !secret.Confirmed {
+		return false
+	}
+	return s.match(uid, secret, code)
+}
+
+//MustEnabled return whether totp of given uid enabled.
+func (s *Service) MustEnabled(uid string) bool {
+	secret := s.store().MustLoadTOTP(uid)
+	return secret != nil && secret.Confirmed
+}
+
+//MustDisable disable totp of given uid.
+func (s *Service) MustDisable(uid string) {
+	s.store().MustRemoveTOTP(uid)
+}
+
+//NewService create new totp service.
+func NewService() *Service {
+	return &Service{
+		Digits:       6,
+		Period:       30 * time.Second,
+		Skew:         1,
+		SecretLength: DefaultSecretLength,
+		Clock:        time.Now,
+	}
+}
@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//DefaultSecretLength default secret length in bytes.
+var DefaultSecretLength = 20
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//NewSecret create new random secret encoded in base32.
+func NewSecret(length int) (string, error) {
+	data := make([]byte, length)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(data), nil
+}
+
+//DecodeSecret decode base32 secret.
+//Spaces and lower case letters are accepted.
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	return secretEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+//HOTP generate rfc 4226 hotp code with given key,counter and digits.
+func HOTP(key []byte, counter int64, digits int) string {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(counter))
+	h := hmac.New(sha1.New, key)
+	h.Write(data[:])
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := int64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	mod := int64(1)
+	for i := 0; i < digits; i++ {
+		mod = mod * 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+//Counter return rfc 6238 time step counter of given time and period.
+func Counter(t time.Time, period time.Duration) int64 {
+	return t.Unix() / int64(period/time.Second)
+}
+
+//Equal compare codes in constant time.
+func Equal(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+//KeyURI return otpauth key uri used by authenticator apps.
+func KeyURI(issuer string, account string, secret string, digits int, period time.Duration) string {
+	label := account
+	if issuer != "" {
+		label = issuer + ":" + account
+	}
+	q := url.Values{}
+	q.Set("secret", secret)
+	if issuer != "" {
+		q.Set("issuer", issuer)
+	}
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(digits))
+	q.Set("period", fmt.Sprint(int64(period/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + label,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
@@ -0,0 +1,203 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/herb-go/herbsystem"
+	"github.com/herb-go/usersystem"
+	"github.com/herb-go/usersystem-drivers/storemodule"
+)
+
+type testStore struct {
+	locker  sync.Mutex
+	data    map[string]*Secret
+	started int
+	stopped int
+}
+
+func (s *testStore) Start() error {
+	s.started++
+	return nil
+}
+func (s *testStore) Stop() error {
+	s.stopped++
+	return nil
+}
+
+func (s *testStore) MustLoadTOTP(uid string) *Secret {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	secret, ok := s.data[uid]
+	if !ok {
+		return nil
+	}
+	result := *secret
+	return &result
+}
+func (s *testStore) MustSaveTOTP(uid string, secret *Secret) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	data := *secret
+	s.data[uid] = &data
+}
+func (s *testStore) MustRemoveTOTP(uid string) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	delete(s.data, uid)
+}
+func (s *testStore) MustUseTOTPCounter(uid string, counter int64) bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	secret, ok := s.data[uid]
+	if !ok || secret.LastCounter >= counter {
+		return false
+	}
+	secret.LastCounter = counter
+	return true
+}
+
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	//RFC 6238 test vectors
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1111111111: "14050471",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+	for k, v := range vectors {
+		code := HOTP(key, Counter(time.Unix(k, 0), 30*time.Second), 8)
+		if code != v {
+			t.Fatal(k, code, v)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	s := NewService()
+	s.Issuer = "test"
+	s.Clock = func() time.Time {
+		return now
+	}
+	s.Store = &testStore{data: map[string]*Secret{}}
+	code := func(secret string, offset int64) string {
+		key, err := DecodeSecret(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return HOTP(key, Counter(now, s.Period)+offset, s.Digits)
+	}
+	uid := "testuid"
+	err := herbsystem.Catch(func() {
+		s.MustConfirm(uid, "000000")
+	})
+	if err != ErrNotEnrolled {
+		t.Fatal(err)
+	}
+	if s.MustVerify(uid, "000000") || s.MustEnabled(uid) {
+		t.Fatal()
+	}
+	e := s.MustEnroll(uid)
+	if e.Secret == "" || e.URI == "" {
+		t.Fatal(e)
+	}
+	if s.MustVerify(uid, code(e.Secret, 0)) {
+		t.Fatal()
+	}
+	e = s.MustEnroll(uid)
+	if s.MustConfirm(uid, code(e.Secret, 3)) {
+		t.Fatal()
+	}
+	if !s.MustConfirm(uid, code(e.Secret, -1)) {
+		t.Fatal()
+	}
+	if !s.MustEnabled(uid) {
+		t.Fatal()
+	}
+	err = herbsystem.Catch(func() {
+		s.MustEnroll(uid)
+	})
+	if err != ErrAlreadyEnabled {
+		t.Fatal(err)
+	}
+	if s.MustVerify(uid, code(e.Secret, -1)) {
+		t.Fatal()
+	}
+	if !s.MustVerify(uid, code(e.Secret, 0)) {
+		t.Fatal()
+	}
+	if s.MustVerify(uid, code(e.Secret, 0)) {
+		t.Fatal()
+	}
+	if s.MustVerify(uid, code(e.Secret, -1)) {
+		t.Fatal()
+	}
+	now = now.Add(s.Period)
+	if !s.MustVerify(uid, code(e.Secret, 0)) {
+		t.Fatal()
+	}
+	s.MustDisable(uid)
+	if s.MustEnabled(uid) || s.MustVerify(uid, code(e.Secret, 1)) {
+		t.Fatal()
+	}
+}
+
+func TestDirective(t *testing.T) {
+	data, err := json.Marshal(map[string]interface{}{
+		"Issuer": "test",
+		"Digits": 8,
+		"Period": "1m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := DirectiveFactory(json.NewDecoder(bytes.NewBuffer(data)).Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := usersystem.New()
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	if MustGetModule(s) != nil {
+		t.Fatal()
+	}
+	err = d.Execute(s)
+	if !errors.Is(err, storemodule.ErrModuleNotInstalled) {
+		t.Fatal(err)
+	}
+	s = usersystem.New()
+	module := MustNewAndInstallTo(s)
+	herbsystem.MustReady(s)
+	herbsystem.MustConfigure(s)
+	err = d.Execute(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := MustGetModule(s)
+	if service != module || service.Issuer != "test" || service.Digits != 8 || service.Period != time.Minute || service.Skew != 1 {
+		t.Fatal(service)
+	}
+	err = herbsystem.Catch(func() {
+		service.MustEnroll("test")
+	})
+	if err != ErrStoreNotSet {
+		t.Fatal(err)
+	}
+	store := &testStore{data: map[string]*Secret{}}
+	service.Store = store
+	herbsystem.MustStart(s)
+	if store.started != 1 || store.stopped != 0 {
+		t.Fatal(store)
+	}
+	herbsystem.MustStop(s)
+	if store.started != 1 || store.stopped != 1 {
+		t.Fatal(store)
+	}
+}